@@ -0,0 +1,229 @@
+package gosysl
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// WriteClient creates the methods of a REST API Client implementing the
+// interface created by WriteInterface over HTTP
+func WriteClient(w io.Writer, app *pb.Application, epNames []string) error {
+	rs, err := getRoutes(app, epNames)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "var _ %s = (*Client)(nil)\n\n", getInterfaceName(app))
+	for _, path := range rs.Paths {
+		for _, op := range path.Operations {
+			writeClientMethod(w, op, HasContext(app))
+		}
+	}
+	return nil
+}
+
+func writeClientMethod(w io.Writer, op *model.Operation, withContext bool) {
+	fmt.Fprintf(w, "// %s calls %s %s\n", op.Name, op.Method, op.Path)
+	fmt.Fprintf(w, "func (c *Client) %s(%s) %s {\n", op.Name, getParams(op, withContext),
+		getReturnTypes(op))
+
+	query, header := "nil", "nil"
+	for _, p := range op.RequestParams() {
+		if p.In == model.InQuery && query == "nil" {
+			query = "q"
+			fmt.Fprintln(w, "q := url.Values{}")
+		}
+		if p.In != model.InQuery && header == "nil" {
+			header = "h"
+			fmt.Fprintln(w, "h := http.Header{}")
+		}
+		writeClientParam(w, p)
+	}
+	payload := "nil"
+	if op.HasBody() && op.Payload != nil {
+		payload = op.Payload.Name
+	}
+	ctx := "context.Background()"
+	if withContext {
+		ctx = "ctx"
+	}
+	urlPath := getClientPath(op.Path, op.PathParams())
+	call := fmt.Sprintf("c.do(%s, \"%s\", %s, %s, %s, %s", ctx, op.Method, urlPath, query,
+		header, payload)
+	if op.Response.Type == "" {
+		fmt.Fprintf(w, "return %s, nil)\n}\n\n", call)
+		return
+	}
+	fmt.Fprintf(w, "var result %s\n", op.Response.Type)
+	fmt.Fprintf(w, "err := %s, &result)\n", call)
+	fmt.Fprint(w, "return result, err\n}\n\n")
+}
+
+// writeClientParam adds all values of a list query, header or cookie parameter
+// and the value of an optional one if not nil
+func writeClientParam(w io.Writer, p *model.Param) {
+	switch p.DeclType() {
+	case "[]" + p.GoType:
+		fmt.Fprintf(w, "for _, v := range %s {\n", p.Var)
+		fmt.Fprintf(w, "%s\n}\n", getClientParamAdd(p, "Add", formatParam(p, "v")))
+	case "*" + p.GoType:
+		fmt.Fprintf(w, "if %s != nil {\n", p.Var)
+		value := formatParam(p, "*"+p.Var)
+		fmt.Fprintf(w, "%s\n}\n", getClientParamAdd(p, "Set", value))
+	default:
+		fmt.Fprintln(w, getClientParamAdd(p, "Set", formatParam(p, p.Var)))
+	}
+}
+
+// getClientParamAdd returns the statement adding or setting a value of a
+// parameter in the query q or the header h, cookies are always added
+func getClientParamAdd(p *model.Param, op, value string) string {
+	switch p.In {
+	case model.InHeader:
+		return fmt.Sprintf("h.%s(\"%s\", %s)", op, p.Name, value)
+	case model.InCookie:
+		cookie := fmt.Sprintf("&http.Cookie{Name: \"%s\", Value: %s}", p.Name, value)
+		return fmt.Sprintf("h.Add(\"Cookie\", (%s).String())", cookie)
+	}
+	return fmt.Sprintf("q.%s(\"%s\", %s)", op, p.Name, value)
+}
+
+var rePathParam = regexp.MustCompile(`{(\w+)}`)
+
+// getClientPath creates the Go expression building the URL path of a route
+// from its path params
+func getClientPath(path string, pathParams []*model.Param) string {
+	expr := rePathParam.ReplaceAllStringFunc(path, func(match string) string {
+		value := match[1 : len(match)-1]
+		for _, p := range pathParams {
+			if p.Name == value {
+				value = formatParam(p, p.Var)
+			}
+		}
+		return `" + url.PathEscape(` + value + `) + "`
+	})
+	expr = `"` + expr + `"`
+	return strings.TrimSuffix(expr, ` + ""`)
+}
+
+const clientPrefix = `import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the REST API served by RestHandler over HTTP.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a new Client for the REST API served at baseURL.
+func NewClient(baseURL string) *Client {
+	return &Client{strings.TrimSuffix(baseURL, "/"), http.DefaultClient}
+}
+
+// ClientError holds the status and body of a non-2xx response and the problem
+// details of an application/problem+json body, it implements DetailedError.
+type ClientError struct {
+	StatusCode int
+	Body       string
+	Problem    Problem
+}
+
+func (e *ClientError) Error() string {
+	msg := e.Body
+	if e.Problem.Detail != "" {
+		msg = e.Problem.Detail
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), msg)
+}
+
+// Status returns the HTTP status code of the response.
+func (e *ClientError) Status() int {
+	return e.StatusCode
+}
+
+// Code returns the error code of the problem details.
+func (e *ClientError) Code() string {
+	return e.Problem.Code
+}
+
+// Details returns the details of the problem details.
+func (e *ClientError) Details() interface{} {
+	return e.Problem.Details
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatDate(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+func formatDateTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values,
+	header http.Header, payload, result interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if _, ok := payload.(MergePatch); ok {
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+	} else if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		b, _ := ioutil.ReadAll(resp.Body) // nolint: gosec
+		body := strings.TrimSpace(string(b))
+		clientErr := &ClientError{StatusCode: resp.StatusCode, Body: body}
+		if resp.Header.Get("Content-Type") == "application/problem+json" {
+			json.Unmarshal(b, &clientErr.Problem) // nolint: errcheck, gosec
+		}
+		return clientErr
+	}
+	if result == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+`
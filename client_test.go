@@ -0,0 +1,79 @@
+package gosysl
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anz-bank/gosysl/pb"
+	"github.com/golang/protobuf/proto"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestGetClientPath(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+	var tests = []struct {
+		input    string
+		expected string
+	}{
+		{"/api", `"/api"`},
+		{"/api/{key}", `"/api/" + url.PathEscape(key)`},
+		{"/a/{key}/x/{y}/z", `"/a/" + url.PathEscape(key) + "/x/" + url.PathEscape(y) + "/z"`},
+	}
+	for _, t := range tests {
+		assert.Equal(t.expected, getClientPath(t.input, nil))
+	}
+}
+
+func TestWriteClient(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+	data, err := ioutil.ReadFile("example/example.pb")
+	assert.NoError(err)
+	module := &pb.Module{}
+	assert.NoError(proto.Unmarshal(data, module))
+	app := module.Apps["RestApi"]
+	epNames := []string{"GET /api/{key}", "POST /api", "DELETE /api/admin/{key}"}
+
+	w := &bytes.Buffer{}
+	assert.NoError(WriteClient(w, app, epNames))
+	expected, _ := format.Source([]byte(expectedClient))
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(string(expected), string(actual))
+
+	ep := &pb.Endpoint{Name: "GET ep"}
+	app = &pb.Application{Endpoints: map[string]*pb.Endpoint{"GET ep": ep}}
+	assert.Error(WriteClient(w, app, []string{"GET ep"}))
+	assert.Error(WriteClient(w, app, []string{"BADMETHOD ep"}))
+
+	_, err = genClientFile(app, []string{"GET ep"}, "pkg")
+	assert.Error(err)
+}
+
+var expectedClient = `var _ Storer = (*Client)(nil)
+
+// GetData calls GET /api/{key}
+func (c *Client) GetData(key string, queryTime string) (Data, error) {
+	q := url.Values{}
+	q.Set("time", queryTime)
+	var result Data
+	err := c.do(context.Background(), "GET", "/api/"+url.PathEscape(key), q, nil, nil, ` +
+	`&result)
+	return result, err
+}
+
+// CreateDataSet calls POST /api
+func (c *Client) CreateDataSet(ds DataSetPayload) (Key, error) {
+	var result Key
+	err := c.do(context.Background(), "POST", "/api", nil, nil, ds, &result)
+	return result, err
+}
+
+// DeleteDataSet calls DELETE /api/admin/{key}
+func (c *Client) DeleteDataSet(key string) error {
+	return c.do(context.Background(), "DELETE", "/api/admin/"+url.PathEscape(key), ` +
+	`nil, nil, nil, nil)
+}
+
+`
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/anz-bank/gosysl"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// layout configures names and placement of the generated files. It is read
+// from the JSON file given with -config, e.g.
+//
+//	{
+//	  "suffix": "_gen",
+//	  "files": {"openapi": "api.json"},
+//	  "types_file": true,
+//	  "server_dir": "server",
+//	  "types_import": "example.com/petstore/gen"
+//	}
+type layout struct {
+	// Prefix and Suffix are added to the base name of every file not named
+	// in Files, e.g. suffix "_gen" creates rest_gen.go and rest_gen_test.go
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+	// Files maps lower case CodeResult field names to file names
+	Files map[string]string `json:"files"`
+	// TypesFile generates the types into types.go instead of storer.go
+	TypesFile bool `json:"types_file"`
+	// ServerDir is the directory of the server package relative to the
+	// output directory, server files are generated with the types if empty
+	ServerDir string `json:"server_dir"`
+	// ServerPackage is the name of the server package, by default derived
+	// from ServerDir
+	ServerPackage string `json:"server_package"`
+	// TypesImport is the import path of the output directory, required with
+	// ServerDir. Packages of multiple applications are imported from sub
+	// directories named after the package.
+	TypesImport string `json:"types_import"`
+}
+
+// readLayout reads the layout from a JSON file and checks the file names
+func readLayout(filename string) (layout, error) {
+	var l layout
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(data, &l); err != nil {
+		return l, fmt.Errorf("invalid layout %s: %v", filename, err)
+	}
+	return l, l.check()
+}
+
+// getLayout returns the layout of the -config file if given, with prefix,
+// suffix and types file of the command line options overriding it if set
+func getLayout(config, prefix, suffix string, typesFile bool) (layout, error) {
+	var l layout
+	if config != "" {
+		var err error
+		if l, err = readLayout(config); err != nil {
+			return l, err
+		}
+	}
+	if prefix != "" {
+		l.Prefix = prefix
+	}
+	if suffix != "" {
+		l.Suffix = suffix
+	}
+	l.TypesFile = l.TypesFile || typesFile
+	return l, nil
+}
+
+func (l layout) check() error {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(gosysl.CodeResult{})
+	for i := 0; i < t.NumField(); i++ {
+		fields[strings.ToLower(t.Field(i).Name)] = true
+	}
+	for key := range l.Files {
+		if !fields[key] {
+			return fmt.Errorf("unknown file %s in layout, use one of %s", key,
+				strings.Join(sortedKeys(fields), ", "))
+		}
+	}
+	if l.ServerDir != "" && l.TypesImport == "" {
+		return fmt.Errorf("server_dir %s requires types_import", l.ServerDir)
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// setAttrs sets the application attributes for the layout of an application
+// in package pkg, multiple is set if more than one application is generated
+func (l layout) setAttrs(app *pb.Application, pkg string, multiple bool) {
+	if l.TypesFile {
+		setAttr(app, "types_file", "true")
+	}
+	if l.ServerDir == "" {
+		return
+	}
+	typesImport := l.TypesImport
+	if multiple {
+		typesImport = path.Join(typesImport, pkg)
+	}
+	setAttr(app, "types_import", typesImport)
+	serverPkg := l.ServerPackage
+	if serverPkg == "" {
+		serverPkg = gosysl.GetPackage(l.ServerDir)
+	}
+	setAttr(app, "server_package", serverPkg)
+}
+
+// filename returns the path of the file of a CodeResult field in outDir
+func (l layout) filename(field reflect.StructField, outDir string) string {
+	if l.ServerDir != "" && field.Tag.Get("server") == "true" {
+		outDir = filepath.Join(outDir, l.ServerDir)
+	}
+	key := strings.ToLower(field.Name)
+	if name, ok := l.Files[key]; ok {
+		return filepath.Join(outDir, name)
+	}
+	base := field.Tag.Get("file")
+	if base == "" {
+		base = key
+	}
+	ext := field.Tag.Get("ext")
+	if ext == "" {
+		ext = ".go"
+	}
+	return filepath.Join(outDir, l.Prefix+base+l.Suffix+ext)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/anz-bank/gosysl"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+// writeLayout writes a layout config file into dir and returns its name
+func writeLayout(tt *testing.T, dir, config string) string {
+	filename := filepath.Join(dir, "layout.json")
+	if err := ioutil.WriteFile(filename, []byte(config), 0644); err != nil {
+		tt.Fatal(err)
+	}
+	return filename
+}
+
+var getLayoutTests = []struct {
+	name      string
+	config    string
+	prefix    string
+	suffix    string
+	typesFile bool
+	expected  layout
+}{
+	{"no config", "", "", "", false, layout{}},
+	{"flags only", "", "api_", "_gen", true,
+		layout{Prefix: "api_", Suffix: "_gen", TypesFile: true}},
+	{"config only", `{"prefix": "p_", "suffix": "_s", "types_file": true}`, "", "", false,
+		layout{Prefix: "p_", Suffix: "_s", TypesFile: true}},
+	{"flags override config", `{"prefix": "p_", "suffix": "_s"}`, "api_", "_gen", true,
+		layout{Prefix: "api_", Suffix: "_gen", TypesFile: true}},
+	{"unset flags keep config", `{"suffix": "_s", "types_file": true}`, "api_", "", false,
+		layout{Prefix: "api_", Suffix: "_s", TypesFile: true}},
+	{"files and server", `{"files": {"openapi": "api.json"}, "server_dir": "srv",
+		"types_import": "example.com/gen"}`, "", "_gen", false,
+		layout{Suffix: "_gen", Files: map[string]string{"openapi": "api.json"},
+			ServerDir: "srv", TypesImport: "example.com/gen"}},
+}
+
+func TestGetLayout(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir, err := ioutil.TempDir("", "layout")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	for _, test := range getLayoutTests {
+		config := ""
+		if test.config != "" {
+			config = writeLayout(tt, dir, test.config)
+		}
+		actual, err := getLayout(config, test.prefix, test.suffix, test.typesFile)
+		assert.NoError(err, test.name)
+		assert.Equal(test.expected, actual, test.name)
+	}
+}
+
+var getLayoutErrorTests = []struct {
+	config   string
+	expected string
+}{
+	{`{"files": {"server": "x.go"}}`, "unknown file server in layout, use one of " +
+		"client, memstorer, middleware, mocks, openapi, rest, resttest, servertypes, " +
+		"storer, types, validate"},
+	{`{"server_dir": "srv"}`, "server_dir srv requires types_import"},
+	{`{"suffix": 1}`, "invalid layout "},
+}
+
+func TestGetLayoutErrors(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir, err := ioutil.TempDir("", "layout")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	for _, test := range getLayoutErrorTests {
+		_, err := getLayout(writeLayout(tt, dir, test.config), "", "", false)
+		if assert.Error(err, test.config) {
+			assert.Contains(err.Error(), test.expected, test.config)
+		}
+	}
+	_, err = getLayout(filepath.Join(dir, "missing.json"), "", "", false)
+	assert.True(os.IsNotExist(err))
+
+	fs := flag.NewFlagSet("sysl-go-rest", flag.ContinueOnError)
+	config := writeLayout(tt, dir, `{"server_dir": "srv"}`)
+	_, err = parseCommand(fs, []string{"-config", config, "in.pb", "pkg"})
+	assert.EqualError(err, "server_dir srv requires types_import")
+}
+
+func TestParseCommandLayout(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir, err := ioutil.TempDir("", "layout")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	config := writeLayout(tt, dir, `{"prefix": "p_", "suffix": "_s"}`)
+	fs := flag.NewFlagSet("sysl-go-rest", flag.ContinueOnError)
+	cmd, err := parseCommand(fs, []string{"-config", config, "-suffix", "_gen", "-types",
+		"in.pb", "pkg"})
+	assert.NoError(err)
+	assert.Equal(layout{Prefix: "p_", Suffix: "_gen", TypesFile: true}, cmd.opts.layout)
+}
+
+// codeResultField returns the CodeResult field of a name
+func codeResultField(name string) reflect.StructField {
+	field, _ := reflect.TypeOf(gosysl.CodeResult{}).FieldByName(name)
+	return field
+}
+
+var filenameTests = []struct {
+	layout   layout
+	field    string
+	expected string
+}{
+	{layout{}, "Rest", "out/rest.go"},
+	{layout{}, "OpenAPI", "out/openapi.json"},
+	{layout{}, "RestTest", "out/rest_test.go"},
+	{layout{}, "MemStorer", "out/memstorer.go"},
+	{layout{}, "ServerTypes", "out/types.go"},
+	{layout{Prefix: "api_"}, "Storer", "out/api_storer.go"},
+	{layout{Suffix: "_gen"}, "Rest", "out/rest_gen.go"},
+	{layout{Suffix: "_gen"}, "RestTest", "out/rest_gen_test.go"},
+	{layout{Prefix: "x", Suffix: "_gen"}, "OpenAPI", "out/xopenapi_gen.json"},
+	{layout{Suffix: "_gen", Files: map[string]string{"openapi": "api.json"}},
+		"OpenAPI", "out/api.json"},
+	{layout{Files: map[string]string{"client": "http/client.go"}},
+		"Client", "out/http/client.go"},
+	{layout{TypesFile: true, Suffix: "_gen"}, "Types", "out/types_gen.go"},
+	{layout{ServerDir: "server"}, "Rest", "out/server/rest.go"},
+	{layout{ServerDir: "server"}, "Middleware", "out/server/middleware.go"},
+	{layout{ServerDir: "server"}, "Mocks", "out/server/mocks.go"},
+	{layout{ServerDir: "server"}, "RestTest", "out/server/rest_test.go"},
+	{layout{ServerDir: "server"}, "ServerTypes", "out/server/types.go"},
+	{layout{ServerDir: "server"}, "Storer", "out/storer.go"},
+	{layout{ServerDir: "server"}, "MemStorer", "out/memstorer.go"},
+	{layout{ServerDir: "cmd/srv", Suffix: "_gen", Files: map[string]string{
+		"rest": "handler.go"}}, "Rest", "out/cmd/srv/handler.go"},
+}
+
+func TestLayoutFilename(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	for _, test := range filenameTests {
+		actual := test.layout.filename(codeResultField(test.field), "out")
+		assert.Equal(filepath.FromSlash(test.expected), actual, "%+v", test.layout)
+	}
+}
+
+var setAttrsTests = []struct {
+	layout   layout
+	multiple bool
+	expected map[string]string
+}{
+	{layout{}, false, map[string]string{}},
+	{layout{TypesFile: true}, false, map[string]string{"types_file": "true"}},
+	{layout{ServerDir: "internal/server", TypesImport: "example.com/gen"}, false,
+		map[string]string{"types_import": "example.com/gen", "server_package": "server"}},
+	{layout{ServerDir: "server", TypesImport: "example.com/gen"}, true,
+		map[string]string{"types_import": "example.com/gen/pets",
+			"server_package": "server"}},
+	{layout{ServerDir: "srv", ServerPackage: "petserver", TypesImport: "example.com/gen",
+		TypesFile: true}, false,
+		map[string]string{"types_import": "example.com/gen", "server_package": "petserver",
+			"types_file": "true"}},
+}
+
+func TestLayoutSetAttrs(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	for _, test := range setAttrsTests {
+		app := &pb.Application{}
+		test.layout.setAttrs(app, "pets", test.multiple)
+		actual := map[string]string{}
+		for name, attr := range app.Attrs {
+			actual[name] = attr.GetS()
+		}
+		assert.Equal(test.expected, actual, "%+v", test.layout)
+	}
+}
+
+// listFiles returns the files in dir relative to it, sorted
+func listFiles(tt *testing.T, dir string) []string {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		tt.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func TestExecuteServerLayout(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir := newTestDir(tt, "example.textpb")
+	defer os.RemoveAll(dir)
+	outDir := filepath.Join(dir, "gen")
+	config := writeLayout(tt, dir, `{"suffix": "_gen", "files": {"openapi": "api.json"},
+		"server_dir": "server", "types_import": "example.com/gen"}`)
+	fs := flag.NewFlagSet("sysl-go-rest", flag.ContinueOnError)
+	cmd, err := parseCommand(fs, []string{"-config", config, "-types", "-tests",
+		filepath.Join(dir, "example.textpb"), outDir})
+	assert.NoError(err)
+	status, err := cmd.execute(ioutil.Discard, ioutil.Discard, nil)
+	assert.NoError(err)
+	assert.Equal(0, status)
+	assert.Equal([]string{
+		"api.json",
+		"client_gen.go",
+		"server/middleware_gen.go",
+		"server/rest_gen.go",
+		"server/rest_gen_test.go",
+		"server/types_gen.go",
+		"storer_gen.go",
+		"types_gen.go",
+		"validate_gen.go",
+	}, listFiles(tt, outDir))
+
+	rest, err := ioutil.ReadFile(filepath.Join(outDir, "server", "rest_gen.go"))
+	assert.NoError(err)
+	assert.Contains(string(rest), "package server\n")
+	aliases, err := ioutil.ReadFile(filepath.Join(outDir, "server", "types_gen.go"))
+	assert.NoError(err)
+	assert.Contains(string(aliases), `"example.com/gen"`)
+	types, err := ioutil.ReadFile(filepath.Join(outDir, "types_gen.go"))
+	assert.NoError(err)
+	assert.Contains(string(types), "package gen\n")
+}
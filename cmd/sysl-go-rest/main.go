@@ -1,56 +1,432 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/anz-bank/gosysl"
 	"github.com/anz-bank/gosysl/pb"
+	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
+	"github.com/pmezard/go-difflib/difflib"
 )
 
 func main() {
 	fmt.Println("sysl-go-rest started")
-	flag.Parse()
-	args := flag.Args()
-	if len(args) != 2 {
-		log.Fatal("Usage: sysl-go-rest <INPUT.pb> <OUTPUT_DIR>")
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cmd, err := parseCommand(fs, os.Args[1:])
+	if err == errUsage {
+		fs.Usage()
+		os.Exit(2)
 	}
-	data, err := ioutil.ReadFile(args[0])
 	if err != nil {
 		log.Fatal(err)
 	}
-	module := &pb.Module{}
-	err = proto.Unmarshal(data, module)
+	status, err := cmd.execute(os.Stdout, os.Stderr, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Exit(status)
+}
+
+// errUsage is returned by parseCommand if the arguments are missing
+var errUsage = errors.New("invalid arguments")
+
+// command holds the parsed command line
+type command struct {
+	input  string
+	outDir string
+	// check diffs against the files on disk instead of writing them
+	check bool
+	// watch regenerates whenever the input file changes, polled every interval
+	watch    bool
+	interval time.Duration
+	opts     options
+}
+
+// parseCommand parses the command line arguments without the program name
+// into fs, the layout of -config is overridden by -prefix, -suffix and -types
+func parseCommand(fs *flag.FlagSet, args []string) (command, error) {
+	appsFlag := fs.String("apps", "", "comma separated list of applications to generate")
+	contextFlag := fs.Bool("context", false, "pass context.Context to Storer methods")
+	memStorerFlag := fs.Bool("memstorer", false, "generate in-memory Storer MemStorer")
+	mocksFlag := fs.Bool("mocks", false, "generate mocks of Storer and Middleware")
+	testsFlag := fs.Bool("tests", false, "generate conformance tests rest_test.go")
+	watchFlag := fs.Bool("watch", false, "regenerate whenever the input file changes")
+	intervalFlag := fs.Duration("interval", time.Second, "polling interval of -watch")
+	formatFlag := fs.String("format", "auto", "input format: auto, binary, text or json")
+	checkFlag := fs.Bool("check", false, "diff against the files on disk, write nothing")
+	configFlag := fs.String("config", "", "JSON file with the layout of generated files")
+	prefixFlag := fs.String("prefix", "", "prefix of generated file names")
+	suffixFlag := fs.String("suffix", "", "suffix of generated file names, e.g. _gen")
+	typesFlag := fs.Bool("types", false, "generate types into types.go")
+	packageFlag := fs.String("package", "", "Go package name, by default the output dir")
+	routerFlag := fs.String("router", "", "router of the REST handler: chi or servemux")
+	templatesFlag := fs.String("templates", "", "directory of override templates")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: sysl-go-rest [OPTIONS] <INPUT.pb> <OUTPUT_DIR>")
+		fmt.Fprintln(fs.Output(), "INPUT.pb is a pb.Module file or - for standard input.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return command{}, err
+	}
+	if fs.NArg() != 2 {
+		return command{}, errUsage
+	}
+	if _, ok := unmarshalers[*formatFlag]; !ok && *formatFlag != "auto" {
+		return command{}, fmt.Errorf("unknown input format %s", *formatFlag)
+	}
+	cmd := command{
+		input:    fs.Arg(0),
+		outDir:   fs.Arg(1),
+		check:    *checkFlag,
+		watch:    *watchFlag,
+		interval: *intervalFlag,
+		opts: options{
+			format: *formatFlag,
+			attrs: map[string]bool{
+				"context":    *contextFlag,
+				"mem_storer": *memStorerFlag,
+				"mocks":      *mocksFlag,
+				"rest_tests": *testsFlag,
+			},
+			pkg:         *packageFlag,
+			router:      *routerFlag,
+			templateDir: *templatesFlag,
+		},
+	}
+	if *appsFlag != "" {
+		cmd.opts.appNames = strings.Split(*appsFlag, ",")
+	}
+	var err error
+	cmd.opts.layout, err = getLayout(*configFlag, *prefixFlag, *suffixFlag, *typesFlag)
+	if err != nil {
+		return command{}, err
+	}
+	if cmd.check && cmd.watch {
+		return command{}, errors.New("-check cannot be combined with -watch")
+	}
+	if cmd.watch && cmd.input == "-" {
+		return command{}, errors.New("cannot watch standard input")
+	}
+	return cmd, nil
+}
+
+// execute generates the files of the command and returns the exit status, 1
+// if -check finds stale files. Progress and diffs are written to stdout. With
+// -watch it regenerates until stop is closed, errors are written to stderr.
+func (c command) execute(stdout, stderr io.Writer, stop <-chan struct{}) (int, error) {
+	if c.check {
+		files, err := run(c.input, c.outDir, c.opts)
+		if err != nil {
+			return 0, err
+		}
+		stale, err := checkFiles(stdout, files)
+		if err != nil {
+			return 0, err
+		}
+		if stale > 0 {
+			fmt.Fprintf(stderr, "%d generated files are out of date\n", stale)
+			return 1, nil
+		}
+		fmt.Fprintf(stdout, "Generated files are up to date\n")
+		return 0, nil
+	}
+	if c.watch {
+		fmt.Fprintf(stdout, "Watching %s\n", c.input)
+		watch(c.input, c.interval, stop, func() {
+			files, err := run(c.input, c.outDir, c.opts)
+			if err == nil {
+				var written []string
+				written, err = writeFiles(files)
+				fmt.Fprintf(stdout, "Regenerated %s, %d files changed\n", c.outDir,
+					len(written))
+			}
+			if err != nil {
+				// keep watching, the input may be fixed with the next change
+				fmt.Fprintln(stderr, err)
+			}
+		})
+		return 0, nil
+	}
+	files, err := run(c.input, c.outDir, c.opts)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := writeFiles(files); err != nil {
+		return 0, err
+	}
+	fmt.Fprintf(stdout, "Finished successfully\n")
+	return 0, nil
+}
+
+// options holds the command line options applied to every generated application
+type options struct {
+	appNames []string
+	// pkg is the package name of a single generated application
+	pkg string
+	// format of the input, auto detected if "auto"
+	format string
+	// attrs holds application attributes set to "true" if enabled
+	attrs map[string]bool
+	// router overrides the router attribute of the applications if set
+	router string
+	// templateDir overrides the template_dir attribute of the applications if set
+	templateDir string
+	layout      layout
+}
+
+// watch calls regenerate initially and whenever the modification time or size
+// of the input file changes, it polls the file every interval until stop is
+// closed and never returns for a nil stop.
+func watch(input string, interval time.Duration, stop <-chan struct{},
+	regenerate func()) {
+	var last os.FileInfo
+	for {
+		info, err := os.Stat(input)
+		switch {
+		case err != nil:
+			log.Print(err)
+		case last == nil || !info.ModTime().Equal(last.ModTime()) ||
+			info.Size() != last.Size():
+			last = info
+			regenerate()
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// genFile is a generated file with its path in the output directory
+type genFile struct {
+	name    string
+	content []byte
+}
+
+// run generates the applications of the input file for the output directory,
+// the files are sorted by name
+func run(input, outDir string, opts options) ([]genFile, error) {
+	module, err := readModule(input, opts.format)
+	if err != nil {
+		return nil, err
+	}
+	apps, err := gosysl.SelectApps(module, opts.appNames...)
+	if err != nil {
+		return nil, fmt.Errorf("application selection error: %v", err)
+	}
+	var files []genFile
+	for pkg, app := range apps {
+		for name, enabled := range opts.attrs {
+			if enabled {
+				setAttr(app, name, "true")
+			}
+		}
+		if opts.router != "" {
+			setAttr(app, "router", opts.router)
+		}
+		if opts.templateDir != "" {
+			setAttr(app, "template_dir", opts.templateDir)
+		}
+		dir := filepath.Join(outDir, pkg)
+		if len(apps) == 1 {
+			dir = outDir
+			if pkg, err = getPackage(app, outDir, opts.pkg); err != nil {
+				return nil, err
+			}
+		} else if opts.pkg != "" {
+			return nil, fmt.Errorf("-package requires a single application, use -apps " +
+				"or set the go_package attribute of the applications")
+		}
+		opts.layout.setAttrs(app, pkg, len(apps) > 1)
+		appFiles, err := generate(app, pkg, dir, opts.layout)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, appFiles...)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// getPackage returns the package name of a single application, given with the
+// -package option, the go_package attribute or derived from the output directory
+func getPackage(app *pb.Application, outDir, pkg string) (string, error) {
+	if pkg != "" {
+		return pkg, gosysl.CheckPackage(pkg)
+	}
+	if pkg, ok := gosysl.GetGoPackage(app); ok {
+		if err := gosysl.CheckPackage(pkg); err != nil {
+			return "", fmt.Errorf("go_package attribute: %v", err)
+		}
+		return pkg, nil
+	}
+	pkg = gosysl.GetPackage(outDir)
+	if err := gosysl.CheckPackage(pkg); err != nil {
+		return "", fmt.Errorf("%v (derived from output directory %s), set it with "+
+			"-package or the go_package attribute", err, outDir)
+	}
+	return pkg, nil
+}
+
+// unmarshalers decode a pb.Module per input format
+var unmarshalers = map[string]func([]byte, proto.Message) error{
+	"binary": proto.Unmarshal,
+	"text": func(data []byte, m proto.Message) error {
+		return proto.UnmarshalText(string(data), m)
+	},
+	"json": func(data []byte, m proto.Message) error {
+		return jsonpb.Unmarshal(bytes.NewReader(data), m)
+	},
+}
+
+// formatExts maps file extensions to input formats
+var formatExts = map[string]string{
+	".pb":        "binary",
+	".textpb":    "text",
+	".txtpb":     "text",
+	".pbtxt":     "text",
+	".prototext": "text",
+	".json":      "json",
+}
+
+// readModule reads a pb.Module from the input file or standard input if input
+// is "-". With format "auto" the format is derived from the file extension or
+// detected from the content.
+func readModule(input, format string) (*pb.Module, error) {
+	var data []byte
+	var err error
+	if input == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(input)
+	}
 	if err != nil {
-		log.Fatal("Unmarshaling error: ", err)
+		return nil, err
+	}
+	if format == "auto" {
+		format = detectFormat(input, data)
+	}
+	module := &pb.Module{}
+	if err := unmarshalers[format](data, module); err != nil {
+		return nil, fmt.Errorf("unmarshaling error (%s format): %v", format, err)
 	}
-	outDir := args[1]
-	os.MkdirAll(outDir, os.ModePerm)
-	if _, err := os.Stat(outDir); err != nil {
-		log.Fatal("Cannot access output directory, error: ", err)
+	return module, nil
+}
+
+// detectFormat returns the input format for the file extension of input or
+// for the content: JSON starts with '{', binary protobuf contains control
+// characters and anything else is taken as text format.
+func detectFormat(input string, data []byte) string {
+	if format, ok := formatExts[strings.ToLower(filepath.Ext(input))]; ok {
+		return format
 	}
-	pkg := gosysl.GetPackage(outDir)
-	result, err := gosysl.Generate(module, pkg)
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return "json"
+	}
+	if !utf8.Valid(trimmed) {
+		return "binary"
+	}
+	for _, b := range trimmed {
+		if b < ' ' && b != '\t' && b != '\n' && b != '\r' {
+			return "binary"
+		}
+	}
+	return "text"
+}
+
+// setAttr sets a string attribute of an application overriding the Sysl
+func setAttr(app *pb.Application, name, value string) {
+	if app.Attrs == nil {
+		app.Attrs = map[string]*pb.Attribute{}
+	}
+	app.Attrs[name] = &pb.Attribute{Attribute: &pb.Attribute_S{S: value}}
+}
+
+// generate returns the files of an application in outDir named by the layout
+func generate(app *pb.Application, pkg, outDir string, l layout) ([]genFile, error) {
+	result, err := gosysl.GenerateApp(app, pkg)
 	if err != nil {
-		log.Fatal("Code generation error: ", err)
+		return nil, fmt.Errorf("code generation error: %v", err)
 	}
 
+	var files []genFile
 	s := reflect.ValueOf(&result).Elem()
 	for i, n := 0, s.NumField(); i < n; i++ {
 		content := s.Field(i).Interface().([]byte)
-		basename := strings.ToLower(s.Type().Field(i).Name)
-		filename := filepath.Join(outDir, basename+".go")
-		err = ioutil.WriteFile(filename, content, 0644)
+		if content == nil {
+			// optional file not generated
+			continue
+		}
+		files = append(files, genFile{l.filename(s.Type().Field(i), outDir), content})
+	}
+	return files, nil
+}
+
+// writeFiles writes the generated files and returns the names of the files
+// written. Files with unchanged content are not rewritten so that their
+// modification time is kept for editors and build caches.
+func writeFiles(files []genFile) ([]string, error) {
+	var written []string
+	for _, f := range files {
+		dir := filepath.Dir(f.name)
+		os.MkdirAll(dir, os.ModePerm)
+		if _, err := os.Stat(dir); err != nil {
+			return written, fmt.Errorf("cannot access output directory: %v", err)
+		}
+		if old, err := ioutil.ReadFile(f.name); err == nil && bytes.Equal(old, f.content) {
+			continue
+		}
+		if err := ioutil.WriteFile(f.name, f.content, 0644); err != nil {
+			return written, fmt.Errorf("cannot write file %s: %v", f.name, err)
+		}
+		written = append(written, f.name)
+	}
+	return written, nil
+}
+
+// checkFiles compares the generated files with the files on disk, prints a
+// unified diff per differing or missing file to w and returns their number
+func checkFiles(w io.Writer, files []genFile) (int, error) {
+	stale := 0
+	for _, f := range files {
+		old, err := ioutil.ReadFile(f.name)
+		if err != nil && !os.IsNotExist(err) {
+			return stale, err
+		}
+		if err == nil && bytes.Equal(old, f.content) {
+			continue
+		}
+		stale++
+		diff := difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(old)),
+			B:        difflib.SplitLines(string(f.content)),
+			FromFile: f.name,
+			ToFile:   f.name + " (generated)",
+			Context:  3,
+		}
 		if err != nil {
-			log.Fatal("Cannot write file ", filename)
+			diff.A, diff.FromFile = nil, "/dev/null"
+		}
+		if err := difflib.WriteUnifiedDiff(w, diff); err != nil {
+			return stale, err
 		}
 	}
-	fmt.Printf("Finished successfully\n")
+	return stale, nil
 }
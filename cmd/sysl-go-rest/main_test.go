@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+const exampleInput = "../../example/example.textpb"
+
+// newTestDir returns a temporary directory with a copy of the example input
+// named input
+func newTestDir(tt *testing.T, input string) string {
+	dir, err := ioutil.TempDir("", "sysl-go-rest")
+	if err != nil {
+		tt.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(exampleInput)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, input), data, 0644); err != nil {
+		tt.Fatal(err)
+	}
+	return dir
+}
+
+// waitFor polls cond until it holds or fails the test after a second
+func waitFor(tt *testing.T, cond func() bool) {
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			tt.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// replaceInFile replaces old by new in a file, changing its size
+func replaceInFile(tt *testing.T, filename, old, new string) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		tt.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte(old), []byte(new), -1)
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		tt.Fatal(err)
+	}
+}
+
+func TestWatch(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir := newTestDir(tt, "example.textpb")
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "example.textpb")
+	calls := make(chan struct{}, 10)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watch(input, time.Millisecond, stop, func() { calls <- struct{}{} })
+		close(done)
+	}()
+
+	// regenerated initially, not again while the input is unchanged
+	<-calls
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(calls, 0)
+
+	replaceInFile(tt, input, `s: "Storer"`, `s: "Backend"`)
+	<-calls
+	close(stop)
+	<-done
+	assert.Len(calls, 0)
+}
+
+func TestExecuteWatch(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir := newTestDir(tt, "example.textpb")
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "example.textpb")
+	outDir := filepath.Join(dir, "pkg")
+	cmd := command{input: input, outDir: outDir, watch: true,
+		interval: time.Millisecond, opts: options{format: "auto"}}
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		status, err := cmd.execute(stdout, stderr, stop)
+		assert.NoError(err)
+		assert.Equal(0, status)
+		close(done)
+	}()
+
+	storer := filepath.Join(outDir, "storer.go")
+	waitFor(tt, func() bool {
+		data, err := ioutil.ReadFile(storer)
+		return err == nil && strings.Contains(string(data), "type Storer interface")
+	})
+	replaceInFile(tt, input, `s: "Storer"`, `s: "Backend"`)
+	waitFor(tt, func() bool {
+		data, err := ioutil.ReadFile(storer)
+		return err == nil && strings.Contains(string(data), "type Backend interface")
+	})
+	close(stop)
+	<-done
+	// only the files naming the Storer interface are rewritten
+	assert.Equal("Watching "+input+"\n"+
+		"Regenerated "+outDir+", 6 files changed\n"+
+		"Regenerated "+outDir+", 2 files changed\n", stdout.String())
+	assert.Empty(stderr.String())
+}
+
+var detectFormatTests = []struct {
+	input    string
+	data     string
+	expected string
+}{
+	{"example.pb", `{"apps": {}}`, "binary"},
+	{"example.PB", "", "binary"},
+	{"example.textpb", "", "text"},
+	{"example.txtpb", "", "text"},
+	{"example.pbtxt", "", "text"},
+	{"example.prototext", "", "text"},
+	{"example.json", "", "json"},
+	{"-", "  \n{\"apps\": {}}", "json"},
+	{"example", "apps {\n\tkey: \"A\"\n}\r\n", "text"},
+	{"example.out", "\n\x03\x0a\x01A", "binary"},
+	{"-", "\xff\xfe", "binary"},
+	{"-", "", "text"},
+}
+
+func TestDetectFormat(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	for _, test := range detectFormatTests {
+		actual := detectFormat(test.input, []byte(test.data))
+		assert.Equal(test.expected, actual, "%s %q", test.input, test.data)
+	}
+}
+
+func TestReadModule(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir := newTestDir(tt, "example.textpb")
+	defer os.RemoveAll(dir)
+	expected, err := readModule(filepath.Join(dir, "example.textpb"), "auto")
+	assert.NoError(err)
+	assert.Contains(expected.Apps, "RestApi")
+
+	// binary and JSON files without extension are detected from the content
+	binary, err := proto.Marshal(expected)
+	assert.NoError(err)
+	json, err := (&jsonpb.Marshaler{}).MarshalToString(expected)
+	assert.NoError(err)
+	files := map[string][]byte{"binary": binary, "json": []byte(json)}
+	for name, data := range files {
+		input := filepath.Join(dir, name)
+		assert.NoError(ioutil.WriteFile(input, data, 0644))
+		actual, err := readModule(input, "auto")
+		assert.NoError(err, name)
+		assert.True(proto.Equal(expected, actual), name)
+		actual, err = readModule(input, name)
+		assert.NoError(err, name)
+		assert.True(proto.Equal(expected, actual), name)
+	}
+
+	_, err = readModule(filepath.Join(dir, "json"), "binary")
+	assert.Error(err)
+	_, err = readModule(filepath.Join(dir, "binary"), "text")
+	assert.Contains(err.Error(), "unmarshaling error (text format): ")
+	_, err = readModule(filepath.Join(dir, "missing"), "auto")
+	assert.True(os.IsNotExist(err))
+
+	// - reads standard input
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin, err = os.Open(filepath.Join(dir, "json"))
+	assert.NoError(err)
+	defer os.Stdin.Close()
+	actual, err := readModule("-", "auto")
+	assert.NoError(err)
+	assert.True(proto.Equal(expected, actual))
+}
+
+func TestParseCommandFormat(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	for _, format := range []string{"auto", "binary", "text", "json"} {
+		fs := flag.NewFlagSet("sysl-go-rest", flag.ContinueOnError)
+		cmd, err := parseCommand(fs, []string{"-format", format, "-", "pkg"})
+		assert.NoError(err)
+		assert.Equal(format, cmd.opts.format)
+		assert.Equal("-", cmd.input)
+	}
+	fs := flag.NewFlagSet("sysl-go-rest", flag.ContinueOnError)
+	_, err := parseCommand(fs, []string{"-format", "yaml", "in.yaml", "pkg"})
+	assert.EqualError(err, "unknown input format yaml")
+}
+
+func TestExecuteCheck(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir := newTestDir(tt, "example.textpb")
+	defer os.RemoveAll(dir)
+	outDir := filepath.Join(dir, "pkg")
+	cmd := command{input: filepath.Join(dir, "example.textpb"), outDir: outDir,
+		check: true, opts: options{format: "auto"}}
+	rest := filepath.Join(outDir, "rest.go")
+
+	// missing files are stale and nothing is written
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status, err := cmd.execute(stdout, stderr, nil)
+	assert.NoError(err)
+	assert.Equal(1, status)
+	assert.Contains(stdout.String(), "--- /dev/null\n+++ "+rest+" (generated)\n")
+	assert.Equal("6 generated files are out of date\n", stderr.String())
+	_, err = os.Stat(outDir)
+	assert.True(os.IsNotExist(err))
+
+	cmd.check = false
+	stdout.Reset()
+	status, err = cmd.execute(stdout, stderr, nil)
+	assert.NoError(err)
+	assert.Equal(0, status)
+	assert.Equal("Finished successfully\n", stdout.String())
+
+	cmd.check = true
+	stdout.Reset()
+	stderr.Reset()
+	status, err = cmd.execute(stdout, stderr, nil)
+	assert.NoError(err)
+	assert.Equal(0, status)
+	assert.Equal("Generated files are up to date\n", stdout.String())
+	assert.Empty(stderr.String())
+
+	// differing files are reported with a unified diff
+	replaceInFile(tt, rest, "func NewRestHandler(", "func NewHandler(")
+	stdout.Reset()
+	status, err = cmd.execute(stdout, stderr, nil)
+	assert.NoError(err)
+	assert.Equal(1, status)
+	assert.True(strings.HasPrefix(stdout.String(),
+		"--- "+rest+"\n+++ "+rest+" (generated)\n@@ "), stdout.String())
+	assert.Contains(stdout.String(), "\n-func NewHandler(")
+	assert.Contains(stdout.String(), "\n+func NewRestHandler(")
+	assert.Equal("1 generated files are out of date\n", stderr.String())
+
+	// files that cannot be read fail the check
+	assert.NoError(os.Remove(rest))
+	assert.NoError(os.Mkdir(rest, 0755))
+	_, err = cmd.execute(stdout, stderr, nil)
+	assert.Error(err)
+}
+
+var parseCommandErrorTests = []struct {
+	args     []string
+	expected string
+}{
+	{[]string{"in.pb"}, errUsage.Error()},
+	{[]string{"in.pb", "pkg", "extra"}, errUsage.Error()},
+	{[]string{"-check", "-watch", "in.pb", "pkg"}, "-check cannot be combined with -watch"},
+	{[]string{"-watch", "-", "pkg"}, "cannot watch standard input"},
+}
+
+func TestParseCommandErrors(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	for _, test := range parseCommandErrorTests {
+		fs := flag.NewFlagSet("sysl-go-rest", flag.ContinueOnError)
+		_, err := parseCommand(fs, test.args)
+		assert.EqualError(err, test.expected, "%v", test.args)
+	}
+}
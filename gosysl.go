@@ -4,36 +4,91 @@ import (
 	"bytes"
 	"fmt"
 	"go/format"
+	"go/token"
+	"io"
+	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
 	"github.com/anz-bank/gosysl/pb"
 )
 
-// CodeResult contains source files' contents as []byte
+// CodeResult contains source files' contents as []byte. Files are named after
+// the field or the base name given in the file tag with the extension given in
+// the ext tag, ".go" by default. Files tagged server belong to the server
+// package, see GetServerPackage. Optional files are nil unless enabled by an
+// application attribute, MemStorer by mem_storer, Mocks by mocks, RestTest by
+// rest_tests, Types by types_file and ServerTypes by types_import.
 type CodeResult struct {
-	Rest       []byte
-	Storer     []byte
-	Middleware []byte
+	Rest        []byte `server:"true"`
+	Storer      []byte
+	Middleware  []byte `server:"true"`
+	Client      []byte
+	Validate    []byte
+	OpenAPI     []byte `ext:".json"`
+	MemStorer   []byte
+	Mocks       []byte `server:"true"`
+	RestTest    []byte `file:"rest" ext:"_test.go" server:"true"`
+	Types       []byte
+	ServerTypes []byte `file:"types" server:"true"`
 }
 
-// Generate creates CodeResult for given Sysl definitions as Proto message (pb.Module)
-func Generate(module *pb.Module, pkg string) (CodeResult, error) {
-	app, err := getApp(module)
+// Generate creates a CodeResult for every application in given Sysl definitions
+// as Proto message (pb.Module). Results are keyed by Go package name, see
+// SelectApps. If appNames are given only the named applications are generated.
+func Generate(module *pb.Module, appNames ...string) (map[string]CodeResult, error) {
+	apps, err := SelectApps(module, appNames...)
 	if err != nil {
-		return CodeResult{}, err
+		return nil, err
+	}
+	result := make(map[string]CodeResult, len(apps))
+	for pkg, app := range apps {
+		code, err := GenerateApp(app, pkg)
+		if err != nil {
+			return nil, err
+		}
+		result[pkg] = code
 	}
+	return result, nil
+}
+
+// GenerateApp creates CodeResult for a single Sysl application in package pkg.
+// The server files are generated in package pkg as well unless a separate
+// server package is set, see GetServerPackage.
+func GenerateApp(app *pb.Application, pkg string) (CodeResult, error) {
 	epNames := sortEpNames(app.Endpoints)
+	serverPkg, _, separate := GetServerPackage(app)
+	if !separate {
+		serverPkg = pkg
+	}
+	for _, p := range []string{pkg, serverPkg} {
+		if err := CheckPackage(p); err != nil {
+			return CodeResult{}, err
+		}
+	}
 	interf, err := genInterfaceFile(app, epNames, pkg)
 	if err != nil {
 		return CodeResult{}, err
 	}
-	middleware, err := genMiddlewareFile(app, epNames, pkg)
+	middleware, err := genMiddlewareFile(app, epNames, serverPkg)
+	if err != nil {
+		return CodeResult{}, err
+	}
+	rest, err := genRestFile(app, epNames, serverPkg)
+	if err != nil {
+		return CodeResult{}, err
+	}
+	client, err := genClientFile(app, epNames, pkg)
+	if err != nil {
+		return CodeResult{}, err
+	}
+	validate, err := genValidateFile(app, pkg)
 	if err != nil {
 		return CodeResult{}, err
 	}
-	rest, err := genRestFile(app, epNames, pkg)
+	openAPI, err := genOpenAPIFile(app, epNames)
 	if err != nil {
 		return CodeResult{}, err
 	}
@@ -41,6 +96,35 @@ func Generate(module *pb.Module, pkg string) (CodeResult, error) {
 		Rest:       rest,
 		Storer:     interf,
 		Middleware: middleware,
+		Client:     client,
+		Validate:   validate,
+		OpenAPI:    openAPI,
+	}
+	if HasMemStorer(app) {
+		if result.MemStorer, err = genMemStorerFile(app, epNames, pkg); err != nil {
+			return CodeResult{}, err
+		}
+	}
+	if HasMocks(app) {
+		if result.Mocks, err = genMocksFile(app, epNames, serverPkg); err != nil {
+			return CodeResult{}, err
+		}
+	}
+	if HasRestTests(app) {
+		result.RestTest, err = genRestTestFile(app, epNames, serverPkg)
+		if err != nil {
+			return CodeResult{}, err
+		}
+	}
+	if HasTypesFile(app) {
+		if result.Types, err = genTypesFile(app, pkg); err != nil {
+			return CodeResult{}, err
+		}
+	}
+	if separate {
+		if result.ServerTypes, err = genServerTypesFile(app, pkg, serverPkg); err != nil {
+			return CodeResult{}, err
+		}
 	}
 	return result, nil
 }
@@ -49,7 +133,15 @@ func genRestFile(app *pb.Application, epNames []string, pkg string) ([]byte, err
 	buffer := &bytes.Buffer{}
 	fmt.Fprintf(buffer, autoGenPrefix, pkg)
 	fmt.Fprintf(buffer, "package %s\n\n", pkg)
-	fmt.Fprintln(buffer, restPrefix)
+	backend, err := getRouterBackend(app)
+	if err != nil {
+		return nil, err
+	}
+	_, _, separate := GetServerPackage(app)
+	writeImports(buffer, getRestImports(backend, separate))
+	if err := writeRestPrefix(buffer, app, backend, separate); err != nil {
+		return nil, err
+	}
 	if err := WriteRest(buffer, app, epNames); err != nil {
 		return nil, err
 	}
@@ -60,12 +152,80 @@ func genInterfaceFile(app *pb.Application, epNames []string, pkg string) ([]byte
 	buffer := &bytes.Buffer{}
 	fmt.Fprintf(buffer, autoGenPrefix, pkg)
 	fmt.Fprintf(buffer, "package %s\n\n", pkg)
+	writeImports(buffer, getInterfaceImports(app, epNames))
 	if err := WriteInterface(buffer, app, epNames); err != nil {
 		return nil, err
 	}
+	if !HasTypesFile(app) {
+		if err := WriteTypes(buffer, app); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func genTypesFile(app *pb.Application, pkg string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, autoGenPrefix, pkg)
+	fmt.Fprintf(buffer, "package %s\n\n", pkg)
+	imports := GetTypesImports(app)
+	if hasServerPackage(app) {
+		imports = addImports(imports, "encoding/json", "errors", "net/http", "reflect")
+	}
+	writeImports(buffer, imports)
 	if err := WriteTypes(buffer, app); err != nil {
 		return nil, err
 	}
+	if hasServerPackage(app) {
+		// MergePatch and Problem are shared with the server package
+		tmpl, err := getTemplates(app)
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.ExecuteTemplate(buffer, "shared", nil); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(buffer.Bytes())
+}
+
+// writeRestPrefix writes the definitions of the REST handler that do not
+// depend on the API with the templates restPrefix and shared, or only
+// validatePayload of shared if the server package is separate
+func writeRestPrefix(w io.Writer, app *pb.Application, backend routerBackend,
+	separate bool) error {
+	tmpl, err := getTemplates(app)
+	if err != nil {
+		return err
+	}
+	if tmpl, err = getBackendTemplates(tmpl, backend); err != nil {
+		return err
+	}
+	if err := tmpl.ExecuteTemplate(w, "restPrefix", nil); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	shared := "shared"
+	if separate {
+		// MergePatch and Problem are defined in the types package
+		shared = "validatePayload"
+	}
+	if err := tmpl.ExecuteTemplate(w, shared, nil); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+func genServerTypesFile(app *pb.Application, pkg, serverPkg string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, autoGenPrefix, serverPkg)
+	fmt.Fprintf(buffer, "package %s\n\n", serverPkg)
+	_, typesImport, _ := GetServerPackage(app)
+	writeImports(buffer, []string{pkg + " " + typesImport})
+	if err := WriteTypeAliases(buffer, app, pkg); err != nil {
+		return nil, err
+	}
 	return format.Source(buffer.Bytes())
 }
 
@@ -74,19 +234,190 @@ func genMiddlewareFile(app *pb.Application, eps []string, pkg string) ([]byte, e
 	fmt.Fprintf(buffer, autoGenPrefix, pkg)
 	fmt.Fprintf(buffer, "package %s\n\n", pkg)
 	fmt.Fprint(buffer, `import "net/http"`+"\n\n")
-	WriteMiddleware(buffer, app, eps)
+	if err := WriteMiddleware(buffer, app, eps); err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func genClientFile(app *pb.Application, epNames []string, pkg string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, autoGenPrefix, pkg)
+	fmt.Fprintf(buffer, "package %s\n\n", pkg)
+	buffer.WriteString(clientPrefix + "\n")
+	if err := WriteClient(buffer, app, epNames); err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func genValidateFile(app *pb.Application, pkg string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, autoGenPrefix, pkg)
+	fmt.Fprintf(buffer, "package %s\n\n", pkg)
+	buffer.WriteString(validatePrefix + "\n")
+	if err := WriteValidate(buffer, app); err != nil {
+		return nil, err
+	}
 	return format.Source(buffer.Bytes())
 }
 
-func getApp(module *pb.Module) (*pb.Application, error) {
+func genMemStorerFile(app *pb.Application, epNames []string, pkg string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, autoGenPrefix, pkg)
+	fmt.Fprintf(buffer, "package %s\n\n", pkg)
+	writeImports(buffer, getMemStorerImports(app, epNames))
+	buffer.WriteString(memStorerPrefix + "\n")
+	if err := WriteMemStorer(buffer, app, epNames); err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func genMocksFile(app *pb.Application, epNames []string, pkg string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, autoGenPrefix, pkg)
+	fmt.Fprintf(buffer, "package %s\n\n", pkg)
+	writeImports(buffer, getMocksImports(app, epNames))
+	buffer.WriteString(mocksPrefix + "\n")
+	if err := WriteMocks(buffer, app, epNames); err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func genRestTestFile(app *pb.Application, epNames []string, pkg string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	fmt.Fprintf(buffer, autoGenPrefix, pkg)
+	fmt.Fprintf(buffer, "package %s\n\n", pkg)
+	writeImports(buffer, getRestTestsImports(app, epNames))
+	buffer.WriteString(restTestsPrefix + "\n")
+	if err := WriteRestTests(buffer, app, epNames); err != nil {
+		return nil, err
+	}
+	return format.Source(buffer.Bytes())
+}
+
+func genOpenAPIFile(app *pb.Application, epNames []string) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	if err := WriteOpenAPI(buffer, app, epNames); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// writeImports writes an import declaration, an empty import separates groups
+// and an import "name path" is imported with given package name
+func writeImports(w io.Writer, imports []string) {
+	if len(imports) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "import (")
+	for _, imp := range imports {
+		switch parts := strings.Fields(imp); len(parts) {
+		case 0:
+			fmt.Fprintln(w)
+		case 1:
+			fmt.Fprintf(w, "\"%s\"\n", imp)
+		default:
+			fmt.Fprintf(w, "%s \"%s\"\n", parts[0], parts[1])
+		}
+	}
+	fmt.Fprint(w, ")\n\n")
+}
+
+// addImports appends the imports that are missing in imports
+func addImports(imports []string, add ...string) []string {
+	for _, imp := range add {
+		if len(removeImport(imports, imp)) == len(imports) {
+			imports = append(imports, imp)
+		}
+	}
+	return imports
+}
+
+// removeImport returns a copy of imports without imp
+func removeImport(imports []string, imp string) []string {
+	result := make([]string, 0, len(imports))
+	for _, i := range imports {
+		if i != imp {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// SelectApps returns the applications of module named in appNames, or all
+// applications if appNames is empty, keyed by Go package name (see GetAppPackage).
+func SelectApps(module *pb.Module, appNames ...string,
+) (map[string]*pb.Application, error) {
 	apps := module.GetApps()
-	if len(apps) > 1 {
-		return nil, fmt.Errorf("cannot handle more than 1 application")
+	if len(apps) == 0 {
+		return nil, fmt.Errorf("need at least 1 application")
+	}
+	if len(appNames) == 0 {
+		appNames = make([]string, 0, len(apps))
+		for name := range apps {
+			appNames = append(appNames, name)
+		}
+	}
+	result := make(map[string]*pb.Application, len(appNames))
+	selected := make(map[string]string, len(appNames))
+	for _, name := range appNames {
+		app, ok := apps[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown application '%s'", name)
+		}
+		pkg := GetAppPackage(name, app)
+		if other, ok := selected[pkg]; ok && other != name {
+			msg := "applications '%s' and '%s' both map to package '%s'"
+			return nil, fmt.Errorf(msg, other, name, pkg)
+		}
+		selected[pkg] = name
+		result[pkg] = app
+	}
+	return result, nil
+}
+
+var reNonIdentifier = regexp.MustCompile(`[^a-z0-9_]`)
+
+// GetAppPackage returns the Go package name of an application set with the
+// go_package attribute or derives it from its AppName.Part, falling back to
+// the module's key for the application.
+func GetAppPackage(name string, app *pb.Application) string {
+	if pkg, ok := GetGoPackage(app); ok {
+		return pkg
+	}
+	parts := app.GetName().GetPart()
+	if len(parts) == 0 {
+		parts = strings.Split(name, "::")
 	}
-	for _, app := range apps {
-		return app, nil
+	pkg := strings.ToLower(strings.Join(parts, ""))
+	return reNonIdentifier.ReplaceAllLiteralString(pkg, "")
+}
+
+// GetGoPackage returns the package name given in the go_package attribute of
+// an application. Like the protobuf option the attribute may hold an import
+// path, the package name is its last element or follows a semicolon, e.g.
+// "example.com/api;apiv2".
+func GetGoPackage(app *pb.Application) (string, bool) {
+	attr, ok := app.Attrs["go_package"]
+	if !ok {
+		return "", false
+	}
+	pkg := attr.GetS()
+	if i := strings.LastIndex(pkg, ";"); i >= 0 {
+		return pkg[i+1:], true
 	}
-	return nil, fmt.Errorf("need at least 1 application")
+	return path.Base(pkg), true
+}
+
+// CheckPackage returns an error if pkg is not a valid Go package name
+func CheckPackage(pkg string) error {
+	if !token.IsIdentifier(pkg) || pkg == "_" {
+		return fmt.Errorf("invalid Go package name '%s': not a Go identifier", pkg)
+	}
+	return nil
 }
 
 // GetPackage extracts package name from output directory
@@ -148,55 +479,9 @@ const autoGenPrefix = `// Package %s is partly autogenerated.
 // This file is AUTOGENERATED -  DO NOT EDIT!
 `
 
-const restPrefix = `import (
-	"context"
-	"encoding/json"
-	"io"
-	"io/ioutil"
-	"net/http"
-
-	"github.com/go-chi/chi"
-	"github.com/go-chi/render"
-)
-
-// RestHandler implements Handler and contains all routes for RefData REST API.
-type RestHandler struct {
-	storer Storer
-	router *chi.Mux
+// restImports are the packages imported by the REST handler and MergePatch, the
+// router backend adds its own
+var restImports = []string{
+	"context", "encoding/json", "errors", "io", "io/ioutil", "net/http", "reflect",
+	"strconv", "time",
 }
-
-func (rh *RestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rh.router.ServeHTTP(w, r)
-}
-
-// StatusError extends the error interface to hold a http.Status
-type StatusError interface {
-	Error() string
-	Status() int
-}
-
-func getStatus(err error) int {
-	if statusErr, ok := err.(StatusError); ok {
-		return statusErr.Status()
-	}
-	return http.StatusInternalServerError
-}
-
-// ContextKeyType is the enum type for keys in Context
-type ContextKeyType int
-
-func makeContextSaver(k ContextKeyType, urlParam string) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			up := chi.URLParam(r, urlParam)
-			ctx := context.WithValue(r.Context(), k, up)
-			next.ServeHTTP(w, r.WithContext(ctx))
-		})
-	}
-}
-
-func decodeJSON(r io.Reader, v interface{}) error {
-	defer io.Copy(ioutil.Discard, r) // nolint: errcheck
-	return json.NewDecoder(r).Decode(v)
-}
-`
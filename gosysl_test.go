@@ -1,10 +1,15 @@
 package gosysl
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"testing"
 
+	"github.com/anz-bank/gosysl/internal/pbtest"
 	"github.com/anz-bank/gosysl/pb"
 	"github.com/golang/protobuf/proto"
 	testifyAssert "github.com/stretchr/testify/assert"
@@ -17,15 +22,21 @@ func TestEnd2End(tt *testing.T) {
 	module := &pb.Module{}
 	err = proto.Unmarshal(data, module)
 	assert.NoError(err)
-	result, err := Generate(module, "mypkg")
+	result, err := GenerateApp(module.Apps["RestApi"], "mypkg")
 	assert.NoError(err)
 	assert.Equal(expectedStorer, string(result.Storer))
 	assert.Equal(expectedMiddleware, string(result.Middleware))
 	assert.Equal(expectedRest, string(result.Rest))
+	assert.Contains(string(result.Client), "func (c *Client) GetKeys() (Keys, error) {")
 
 	// failing gofmt
-	_, err = Generate(module, "BAD PACKAGE NAME")
+	_, err = GenerateApp(module.Apps["RestApi"], "BAD PACKAGE NAME")
 	assert.Error(err)
+
+	results, err := Generate(module)
+	assert.NoError(err)
+	assert.Len(results, 1)
+	assert.Contains(string(results["restapi"].Storer), "package restapi\n")
 }
 
 func TestGetPackage(tt *testing.T) {
@@ -36,15 +47,129 @@ func TestGetPackage(tt *testing.T) {
 	assert.Equal("y", GetPackage("x/y/"))
 }
 
-func TestGetApp(tt *testing.T) {
+func TestGetAppPackage(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	assert.Equal("x", GetAppPackage("x", &pb.Application{}))
+	pkg := GetAppPackage("Platform :: Accounts", &pb.Application{})
+	assert.Equal("platformaccounts", pkg)
+	app := &pb.Application{Name: &pb.AppName{Part: []string{"Rest-Api", "V2"}}}
+	assert.Equal("restapiv2", GetAppPackage("ignored", app))
+	app.Attrs = map[string]*pb.Attribute{"go_package": pbtest.NewStringAttr("api")}
+	assert.Equal("api", GetAppPackage("ignored", app))
+}
+
+func TestGetGoPackage(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := &pb.Application{}
+	_, ok := GetGoPackage(app)
+	assert.False(ok)
+	app.Attrs = map[string]*pb.Attribute{
+		"go_package": pbtest.NewStringAttr("example.com/api"),
+	}
+	pkg, ok := GetGoPackage(app)
+	assert.True(ok)
+	assert.Equal("api", pkg)
+	app.Attrs["go_package"] = pbtest.NewStringAttr("example.com/api-v2;apiv2")
+	pkg, _ = GetGoPackage(app)
+	assert.Equal("apiv2", pkg)
+}
+
+func TestCheckPackage(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	assert.NoError(CheckPackage("api"))
+	assert.NoError(CheckPackage("api_v2"))
+	for _, pkg := range []string{"api-v2", "2api", "", "_", "type", "my api"} {
+		assert.EqualError(CheckPackage(pkg),
+			"invalid Go package name '"+pkg+"': not a Go identifier")
+	}
+	_, err := GenerateApp(&pb.Application{}, "api-v2")
+	assert.EqualError(err, "invalid Go package name 'api-v2': not a Go identifier")
+}
+
+func TestSelectApps(tt *testing.T) {
 	assert := testifyAssert.New(tt)
 
 	module := &pb.Module{}
+	_, err := SelectApps(module)
+	assert.Error(err)
+
 	module.Apps = map[string]*pb.Application{}
-	module.Apps["1"] = nil
-	module.Apps["2"] = nil
-	_, err := getApp(module)
+	module.Apps["A"] = &pb.Application{Name: &pb.AppName{Part: []string{"A"}}}
+	module.Apps["B"] = &pb.Application{Name: &pb.AppName{Part: []string{"B"}}}
+	module.Apps["C"] = &pb.Application{Name: &pb.AppName{Part: []string{"C"}}}
+	apps, err := SelectApps(module)
+	assert.NoError(err)
+	assert.Len(apps, 3)
+	assert.Equal(module.Apps["B"], apps["b"])
+
+	apps, err = SelectApps(module, "A", "C")
+	assert.NoError(err)
+	assert.Len(apps, 2)
+	assert.Equal(module.Apps["C"], apps["c"])
+
+	_, err = SelectApps(module, "D")
 	assert.Error(err)
+
+	module.Apps["a"] = &pb.Application{}
+	_, err = SelectApps(module)
+	assert.Error(err)
+
+	delete(module.Apps, "a")
+	results, err := Generate(module)
+	assert.NoError(err)
+	assert.Len(results, 3)
+	assert.Contains(string(results["c"].Rest), "package c\n")
+}
+
+// runGenerated generates app in package gen of a temporary module and runs
+// go test on it with the given test file. The app has to use the servemux
+// router, so the generated code only depends on the standard library and
+// needs Go 1.22 for method and wildcard patterns.
+func runGenerated(tt *testing.T, app *pb.Application, test string) {
+	assert := testifyAssert.New(tt)
+	if testing.Short() {
+		tt.Skip("skip compiling generated code in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		tt.Skip("go tool not found")
+	}
+	result, err := GenerateApp(app, "gen")
+	if !assert.NoError(err) {
+		return
+	}
+	dir, err := ioutil.TempDir("", "gosysl")
+	if !assert.NoError(err) {
+		return
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	files := map[string][]byte{
+		"go.mod":        []byte("module gen\n\ngo 1.22\n"),
+		"rest.go":       result.Rest,
+		"storer.go":     result.Storer,
+		"middleware.go": result.Middleware,
+		"client.go":     result.Client,
+		"validate.go":   result.Validate,
+		"memstorer.go":  result.MemStorer,
+		"mocks.go":      result.Mocks,
+		"types.go":      result.Types,
+		"gen_test.go":   []byte(test),
+	}
+	for name, content := range files {
+		if content == nil {
+			continue
+		}
+		err := ioutil.WriteFile(filepath.Join(dir, name), content, 0644)
+		assert.NoError(err)
+	}
+	cmd := exec.Command(goTool, "test", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOWORK=off")
+	out, err := cmd.CombinedOutput()
+	assert.NoError(err, string(out))
 }
 
 var expectedStorer = fmt.Sprintf(autoGenPrefix, `mypkg`) + `package mypkg
@@ -190,89 +315,136 @@ type Middleware interface {
 }
 `
 
-var expectedRest = fmt.Sprintf(autoGenPrefix, `mypkg`) + "package mypkg\n\n" +
-	restPrefix + `
-// Keys for Context lookup
+// builtinRestPrefix returns the built-in restPrefix and shared templates of the
+// chi backend
+func builtinRestPrefix() string {
+	buffer := &bytes.Buffer{}
+	if err := writeRestPrefix(buffer, &pb.Application{}, chiBackend{}, false); err != nil {
+		panic(err)
+	}
+	return buffer.String()
+}
+
+var expectedRest = fmt.Sprintf(autoGenPrefix, `mypkg`) + "package mypkg\n\n" + `import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+)
+
+` + builtinRestPrefix() + `// Keys for Context lookup
 const (
 	KeyKey ContextKeyType = iota
 	StartTimeKey
 )
 
 // NewRestHandler creates a new Handler persisting data to Storer.
-func NewRestHandler(s Storer, m Middleware) RestHandler {
+func NewRestHandler(s Storer, m Middleware, opts ...RestOption) RestHandler {
 	r := chi.NewRouter()
 	r.Use(m.Root()...)
-	rh := RestHandler{s, r}
+	rh := RestHandler{storer: s, router: r, encodeError: EncodeProblem}
+	for _, opt := range opts {
+		opt(&rh)
+	}
 
 	r.Route("/api", func(r chi.Router) {
 		r.Use(m.AuthorizeRoot()...)
 		r.Get("/", rh.handleGetKeys)
+		r.Head("/", rh.handleGetKeys)
 		r.Post("/", rh.handleCreateDataSet)
+		r.Options("/", makeOptionsHandler("GET, HEAD, POST, OPTIONS"))
 	})
 	r.Route("/api/{key}/name", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeDataSet()...)
 		r.Get("/", rh.handleGetDataSetName)
+		r.Head("/", rh.handleGetDataSetName)
 		r.Put("/", rh.handlePutDataSetName)
+		r.Options("/", makeOptionsHandler("GET, HEAD, PUT, OPTIONS"))
 	})
 	r.Route("/api/{key}", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeDataSet()...)
 		r.Get("/", rh.handleGetData)
+		r.Head("/", rh.handleGetData)
 		r.Put("/", rh.handlePutData)
+		r.Options("/", makeOptionsHandler("GET, HEAD, PUT, OPTIONS"))
 	})
 	r.Route("/api/{key}/{startTime}", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(makeContextSaver(StartTimeKey, "startTime"))
 		r.Use(m.AuthorizeDataSet()...)
 		r.Get("/", rh.handleGetDataWithStart)
+		r.Head("/", rh.handleGetDataWithStart)
 		r.Put("/", rh.handlePutDataWithStart)
 		r.Delete("/", rh.handleDeleteData)
+		r.Options("/", makeOptionsHandler("GET, HEAD, PUT, DELETE, OPTIONS"))
 	})
 	r.Route("/api/{key}/schema", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeDataSet()...)
 		r.Get("/", rh.handleGetSchema)
+		r.Head("/", rh.handleGetSchema)
 		r.Put("/", rh.handlePutSchema)
+		r.Options("/", makeOptionsHandler("GET, HEAD, PUT, OPTIONS"))
 	})
 	r.Route("/api/{key}/schema/{startTime}", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(makeContextSaver(StartTimeKey, "startTime"))
 		r.Use(m.AuthorizeDataSet()...)
 		r.Get("/", rh.handleGetSchemaWithStart)
+		r.Head("/", rh.handleGetSchemaWithStart)
 		r.Put("/", rh.handlePutSchemaWithStart)
 		r.Delete("/", rh.handleDeleteSchema)
+		r.Options("/", makeOptionsHandler("GET, HEAD, PUT, DELETE, OPTIONS"))
 	})
 	r.Route("/api/admin/{key}", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeAdmin()...)
 		r.Delete("/", rh.handleDeleteDataSet)
+		r.Options("/", makeOptionsHandler("DELETE, OPTIONS"))
 	})
 	r.Route("/api/admin/{key}/start-times", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeAdmin()...)
 		r.Get("/", rh.handleGetStartTimes)
+		r.Head("/", rh.handleGetStartTimes)
+		r.Options("/", makeOptionsHandler("GET, HEAD, OPTIONS"))
 	})
 	r.Route("/api/admin/{key}/creation-times", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeAdmin()...)
 		r.Get("/", rh.handleGetCreationTimes)
+		r.Head("/", rh.handleGetCreationTimes)
+		r.Options("/", makeOptionsHandler("GET, HEAD, OPTIONS"))
 	})
 	r.Route("/api/admin/{key}/restrictions", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeAdmin()...)
 		r.Get("/", rh.handleGetRestriction)
+		r.Head("/", rh.handleGetRestriction)
 		r.Put("/", rh.handlePutRestriction)
+		r.Options("/", makeOptionsHandler("GET, HEAD, PUT, OPTIONS"))
 	})
 	r.Route("/api/admin/{key}/subscribe", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeAdmin()...)
 		r.Post("/", rh.handlePutSubscription)
+		r.Options("/", makeOptionsHandler("POST, OPTIONS"))
 	})
 	r.Route("/api/admin/{key}/unsubscribe", func(r chi.Router) {
 		r.Use(makeContextSaver(KeyKey, "key"))
 		r.Use(m.AuthorizeAdmin()...)
 		r.Post("/", rh.handleDeleteSubscription)
+		r.Options("/", makeOptionsHandler("POST, OPTIONS"))
 	})
 	return rh
 }
@@ -280,7 +452,7 @@ func NewRestHandler(s Storer, m Middleware) RestHandler {
 func (rh *RestHandler) handleGetKeys(w http.ResponseWriter, r *http.Request) {
 	result, err := rh.storer.GetKeys()
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -288,14 +460,19 @@ func (rh *RestHandler) handleGetKeys(w http.ResponseWriter, r *http.Request) {
 
 func (rh *RestHandler) handleCreateDataSet(w http.ResponseWriter, r *http.Request) {
 	var payload DataSetPayload
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.CreateDataSet(payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.Status(r, http.StatusCreated)
@@ -306,7 +483,7 @@ func (rh *RestHandler) handleGetDataSetName(w http.ResponseWriter, r *http.Reque
 	key := r.Context().Value(KeyKey).(string)
 	result, err := rh.storer.GetDataSetName(key)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -315,14 +492,19 @@ func (rh *RestHandler) handleGetDataSetName(w http.ResponseWriter, r *http.Reque
 func (rh *RestHandler) handlePutDataSetName(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
 	var payload NamePayload
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.PutDataSetName(key, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -330,10 +512,15 @@ func (rh *RestHandler) handlePutDataSetName(w http.ResponseWriter, r *http.Reque
 
 func (rh *RestHandler) handleGetData(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
-	time := r.URL.Query().Get("time")
-	result, err := rh.storer.GetData(key, time)
+	if len(r.URL.Query()["time"]) == 0 {
+		err := errors.New("missing parameter time")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	queryTime := r.URL.Query().Get("time")
+	result, err := rh.storer.GetData(key, queryTime)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -342,14 +529,19 @@ func (rh *RestHandler) handleGetData(w http.ResponseWriter, r *http.Request) {
 func (rh *RestHandler) handlePutData(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
 	var payload DataPayload
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.PutData(key, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -360,7 +552,7 @@ func (rh *RestHandler) handleGetDataWithStart(w http.ResponseWriter, r *http.Req
 	startTime := r.Context().Value(StartTimeKey).(string)
 	result, err := rh.storer.GetDataWithStart(key, startTime)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -370,14 +562,19 @@ func (rh *RestHandler) handlePutDataWithStart(w http.ResponseWriter, r *http.Req
 	key := r.Context().Value(KeyKey).(string)
 	startTime := r.Context().Value(StartTimeKey).(string)
 	var payload DataPayload
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.PutDataWithStart(key, startTime, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -387,7 +584,7 @@ func (rh *RestHandler) handleDeleteData(w http.ResponseWriter, r *http.Request)
 	key := r.Context().Value(KeyKey).(string)
 	startTime := r.Context().Value(StartTimeKey).(string)
 	if err := rh.storer.DeleteData(key, startTime); err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.NoContent(w, r)
@@ -395,10 +592,15 @@ func (rh *RestHandler) handleDeleteData(w http.ResponseWriter, r *http.Request)
 
 func (rh *RestHandler) handleGetSchema(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
-	time := r.URL.Query().Get("time")
-	result, err := rh.storer.GetSchema(key, time)
+	if len(r.URL.Query()["time"]) == 0 {
+		err := errors.New("missing parameter time")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	queryTime := r.URL.Query().Get("time")
+	result, err := rh.storer.GetSchema(key, queryTime)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -407,14 +609,19 @@ func (rh *RestHandler) handleGetSchema(w http.ResponseWriter, r *http.Request) {
 func (rh *RestHandler) handlePutSchema(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
 	var payload SchemaPayload
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.PutSchema(key, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -425,7 +632,7 @@ func (rh *RestHandler) handleGetSchemaWithStart(w http.ResponseWriter, r *http.R
 	startTime := r.Context().Value(StartTimeKey).(string)
 	result, err := rh.storer.GetSchemaWithStart(key, startTime)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -435,14 +642,19 @@ func (rh *RestHandler) handlePutSchemaWithStart(w http.ResponseWriter, r *http.R
 	key := r.Context().Value(KeyKey).(string)
 	startTime := r.Context().Value(StartTimeKey).(string)
 	var payload SchemaPayload
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.PutSchemaWithStart(key, startTime, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -452,7 +664,7 @@ func (rh *RestHandler) handleDeleteSchema(w http.ResponseWriter, r *http.Request
 	key := r.Context().Value(KeyKey).(string)
 	startTime := r.Context().Value(StartTimeKey).(string)
 	if err := rh.storer.DeleteSchema(key, startTime); err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.NoContent(w, r)
@@ -461,7 +673,7 @@ func (rh *RestHandler) handleDeleteSchema(w http.ResponseWriter, r *http.Request
 func (rh *RestHandler) handleDeleteDataSet(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
 	if err := rh.storer.DeleteDataSet(key); err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.NoContent(w, r)
@@ -471,7 +683,7 @@ func (rh *RestHandler) handleGetStartTimes(w http.ResponseWriter, r *http.Reques
 	key := r.Context().Value(KeyKey).(string)
 	result, err := rh.storer.GetStartTimes(key)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -481,7 +693,7 @@ func (rh *RestHandler) handleGetCreationTimes(w http.ResponseWriter, r *http.Req
 	key := r.Context().Value(KeyKey).(string)
 	result, err := rh.storer.GetCreationTimes(key)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -491,7 +703,7 @@ func (rh *RestHandler) handleGetRestriction(w http.ResponseWriter, r *http.Reque
 	key := r.Context().Value(KeyKey).(string)
 	result, err := rh.storer.GetRestriction(key)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -500,14 +712,19 @@ func (rh *RestHandler) handleGetRestriction(w http.ResponseWriter, r *http.Reque
 func (rh *RestHandler) handlePutRestriction(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
 	var payload Restriction
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.PutRestriction(key, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.JSON(w, r, result)
@@ -516,14 +733,19 @@ func (rh *RestHandler) handlePutRestriction(w http.ResponseWriter, r *http.Reque
 func (rh *RestHandler) handlePutSubscription(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
 	var payload Subscription
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.PutSubscription(key, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.Status(r, http.StatusCreated)
@@ -533,14 +755,19 @@ func (rh *RestHandler) handlePutSubscription(w http.ResponseWriter, r *http.Requ
 func (rh *RestHandler) handleDeleteSubscription(w http.ResponseWriter, r *http.Request) {
 	key := r.Context().Value(KeyKey).(string)
 	var payload Subscription
-	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	data, err := decodeJSON(r.Body, &payload)
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := validatePayload(payload, data); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
 	result, err := rh.storer.DeleteSubscription(key, payload)
 	if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
+		rh.encodeError(w, r, getStatus(err), err)
 		return
 	}
 	render.Status(r, http.StatusCreated)
@@ -3,108 +3,137 @@ package gosysl
 import (
 	"fmt"
 	"io"
-	"regexp"
 	"strings"
 
+	"github.com/anz-bank/gosysl/model"
 	"github.com/anz-bank/gosysl/pb"
 )
 
-var reMethodRemove = regexp.MustCompile(`[{}\s]`)
-var reMethodSeparate = regexp.MustCompile(`[._,#-]`)
-
 // GetMethodName creates the interface method name from pattern path
 func GetMethodName(ep *pb.Endpoint) string {
-	if n, ok := ep.Attrs["method_name"]; ok {
-		return n.GetS()
-	}
-	name := reMethodRemove.ReplaceAllLiteralString(ep.Name, "")
-	name = reMethodSeparate.ReplaceAllLiteralString(name, "/")
+	return model.GetMethodName(ep)
+}
+
+// HasContext reports whether the interface methods of an application take a
+// context.Context as first parameter, set with the app attribute context="true"
+func HasContext(app *pb.Application) bool {
+	return app.Attrs["context"].GetS() == "true"
+}
 
-	fields := strings.Split(name, "/")
-	for i, field := range fields {
-		fields[i] = strings.Title(strings.ToLower(field))
+// getParams returns the parameter list of the interface method of an operation
+func getParams(op *model.Operation, withContext bool) string {
+	names, types := getParamDefs(op, withContext)
+	params := make([]string, len(names))
+	for i, name := range names {
+		params[i] = name + " " + types[i]
 	}
-	return strings.Join(fields, "")
+	return strings.Join(params, ", ")
 }
 
-var curlyRe = regexp.MustCompile(`^\s*{\s*(\w+)\s*<:\s*(\w+)\s*}\s*$`)
+// getParamDefs returns the names and Go types of the parameters of the
+// interface method of an operation
+func getParamDefs(op *model.Operation, withContext bool) ([]string, []string) {
+	names, types := make([]string, 0, 8), make([]string, 0, 8)
+	if withContext {
+		names, types = append(names, "ctx"), append(types, "context.Context")
+	}
+	for _, p := range op.Params {
+		names, types = append(names, p.Var), append(types, p.DeclType())
+	}
+	if op.Payload != nil {
+		names, types = append(names, op.Payload.Name), append(types, op.Payload.GoType())
+	}
+	return names, types
+}
 
-func getParams(ep *pb.Endpoint) (string, error) {
-	if ep.RestParams == nil {
-		return "", nil
+// getInterfaceImports returns the packages imported by the interface and,
+// unless generated into their own file, type definitions of an application
+func getInterfaceImports(app *pb.Application, epNames []string) []string {
+	imports := []string{}
+	if !HasTypesFile(app) {
+		imports = GetTypesImports(app)
 	}
-	patternParams := make([]string, 0, 8)
-	queryParams := make([]string, 0, 8)
-	for _, param := range ep.RestParams.QueryParam {
-		name := param.Name
-		typeStr, _, err := GetType(param.Type)
-		if err != nil {
-			return "", err
-		}
-		matches := curlyRe.FindAllStringSubmatch(typeStr, -1)
-		if len(matches) == 1 {
-			name = matches[0][1]
-			typeStr = matches[0][2]
-			queryParams = append(queryParams, fmt.Sprintf("%s %s", name, typeStr))
-		} else {
-			qp := []string{fmt.Sprintf("%s %s", name, typeStr)}
-			patternParams = append(qp, patternParams...)
+	if HasContext(app) {
+		imports = append([]string{"context"}, imports...)
+	}
+	for _, imp := range imports {
+		if imp == "time" {
+			return imports
 		}
 	}
-	params := append(patternParams, queryParams...)
-	for _, param := range ep.Param {
-		typeStr := param.Type.GetTypeRef().Ref.Appname.Part[0]
-		params = append(params, fmt.Sprintf("%s %s", param.Name, typeStr))
+	if hasTimeParams(app, epNames) {
+		return append(imports, "time")
 	}
-	return strings.Join(params, ", "), nil
+	return imports
 }
 
-func getReturnTypes(ep *pb.Endpoint) (string, error) {
-	for _, s := range ep.Stmt {
-		if s.GetAction() != nil && s.GetAction().GetAction() == "return" {
-			// simple return type without value
-			return "error", nil
-		}
-		if s.GetRet() != nil {
-			retType := s.GetRet().GetPayload()
-			return fmt.Sprintf("(%s, error)", retType), nil
+// hasTimeParams reports whether a parameter of the endpoints is a time.Time
+func hasTimeParams(app *pb.Application, epNames []string) bool {
+	for _, name := range epNames {
+		params, _ := model.GetParams(app.Endpoints[name])
+		for _, p := range params {
+			if p.GoType == "time.Time" {
+				return true
+			}
 		}
 	}
-	return "", fmt.Errorf("return missing in endpoint %s", ep.String())
+	return false
 }
 
-func writeMethod(w io.Writer, ep *pb.Endpoint) error {
-	if attr, ok := ep.Attrs["method_doc"]; ok {
-		fmt.Fprintf(w, "\n// %s \n", attr.GetS())
-	}
-	name := GetMethodName(ep)
-	params, err := getParams(ep)
-	if err != nil {
-		return err
+// getReturnTypes returns the result types of the interface method of an
+// operation
+func getReturnTypes(op *model.Operation) string {
+	if op.Response.Type == "" {
+		return "error"
 	}
-	returnTypes, err := getReturnTypes(ep)
-	if err != nil {
-		return err
-	}
-	fmt.Fprintf(w, "%s(%s) %s\n", name, params, returnTypes)
-	return nil
+	return fmt.Sprintf("(%s, error)", op.Response.Type)
+}
+
+// interfaceData is the template data of the Storer interface
+type interfaceData struct {
+	Name    string
+	Doc     string
+	Methods []methodData
+}
+
+// methodData is the template data of an interface method with its parameter
+// list and result types
+type methodData struct {
+	Name    string
+	Doc     string
+	Params  string
+	Results string
+}
+
+func getMethodData(op *model.Operation, withContext bool) methodData {
+	params := getParams(op, withContext)
+	return methodData{op.Name, op.Doc, params, getReturnTypes(op)}
 }
 
 // WriteInterface creates for methods called in REST endpoints.
 func WriteInterface(w io.Writer, app *pb.Application, epNames []string) error {
-	if attr, ok := app.Attrs["interface_doc"]; ok {
-		fmt.Fprintf(w, "// %s \n", attr.GetS())
+	tmpl, err := getTemplates(app)
+	if err != nil {
+		return err
 	}
-	interfaceName := "Storer"
-	if attr, ok := app.Attrs["interface"]; ok {
-		interfaceName = strings.Title(attr.GetS())
+	data := interfaceData{
+		Name:    getInterfaceName(app),
+		Doc:     app.Attrs["interface_doc"].GetS(),
+		Methods: make([]methodData, 0, len(epNames)),
 	}
-	fmt.Fprintf(w, "type %s interface {\n", interfaceName)
 	for _, name := range epNames {
-		if err := writeMethod(w, app.Endpoints[name]); err != nil {
+		op, err := model.NewOperation(app, name)
+		if err != nil {
 			return err
 		}
+		data.Methods = append(data.Methods, getMethodData(op, HasContext(app)))
+	}
+	return tmpl.ExecuteTemplate(w, "interface", data)
+}
+
+func getInterfaceName(app *pb.Application) string {
+	if attr, ok := app.Attrs["interface"]; ok {
+		return strings.Title(attr.GetS())
 	}
-	fmt.Fprintln(w, "}")
-	return nil
+	return "Storer"
 }
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"testing"
 
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/model"
 	"github.com/anz-bank/gosysl/pb"
 	testifyAssert "github.com/stretchr/testify/assert"
 )
@@ -34,20 +36,23 @@ func TestBadInput(tt *testing.T) {
 	qpSlice := []*pb.Endpoint_RestParams_QueryParam{qp}
 	rp := &pb.Endpoint_RestParams{QueryParam: qpSlice}
 	ep := &pb.Endpoint{RestParams: rp}
-	_, err := getParams(ep)
+	_, err := model.GetParams(ep)
 	assert.Error(err)
 
-	_, err = getReturnTypes(ep)
+	_, err = model.GetResultType(ep)
 	assert.Error(err)
 
 	w := &bytes.Buffer{}
-	assert.Error(writeMethod(w, ep))
-	ep.RestParams.QueryParam = nil
-	assert.Error(writeMethod(w, ep))
-
+	ep.Name = "GET /x"
 	app := &pb.Application{
-		Endpoints: map[string]*pb.Endpoint{"x": ep},
+		Endpoints: map[string]*pb.Endpoint{ep.Name: ep},
 	}
+	assert.Error(WriteInterface(w, app, []string{ep.Name}))
+	ep.RestParams.QueryParam = nil
+	assert.Error(WriteInterface(w, app, []string{ep.Name}))
+
+	ep.Name = "x"
+	app.Endpoints = map[string]*pb.Endpoint{"x": ep}
 	assert.Error(WriteInterface(w, app, []string{"x"}))
 
 	_, err = genInterfaceFile(app, []string{"x"}, "pkg")
@@ -63,6 +68,49 @@ func TestBadInput(tt *testing.T) {
 	module := &pb.Module{
 		Apps: map[string]*pb.Application{"x": app},
 	}
-	_, err = Generate(module, "x")
+	_, err = Generate(module)
 	assert.Error(err)
 }
+
+func TestGetParamsPayloadOnly(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Appname: &pb.AppName{Part: []string{"Pet"}}}}
+	param := &pb.Param{Name: "pet", Type: &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}}}
+	ep := &pb.Endpoint{Name: "POST /pets", Param: []*pb.Param{param}}
+	op := &model.Operation{Payload: model.GetPayload(ep)}
+	assert.Equal("pet Pet", getParams(op, false))
+}
+
+func TestContext(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Appname: &pb.AppName{Part: []string{"Pet"}}}}
+	param := &pb.Param{Name: "pet", Type: &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}}}
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Pet"}}}
+	ep := &pb.Endpoint{Name: "POST /pets", Param: []*pb.Param{param}}
+	ep.Stmt = []*pb.Statement{ret}
+	app := &pb.Application{
+		Attrs:     map[string]*pb.Attribute{"context": pbtest.NewStringAttr("true")},
+		Endpoints: map[string]*pb.Endpoint{ep.Name: ep},
+	}
+	assert.True(HasContext(app))
+	assert.Contains(getInterfaceImports(app, []string{ep.Name}), "context")
+
+	w := &bytes.Buffer{}
+	assert.NoError(WriteInterface(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), "PostPets(ctx context.Context, pet Pet) (Pet, error)\n")
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), "rh.storer.PostPets(r.Context(), payload)")
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteClient(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), "func (c *Client) PostPets(ctx context.Context, pet Pet)")
+	assert.Contains(w.String(), `c.do(ctx, "POST", "/pets", nil, nil, pet, &result)`)
+
+	app.Attrs = nil
+	assert.False(HasContext(app))
+	assert.NotContains(getInterfaceImports(app, []string{ep.Name}), "context")
+}
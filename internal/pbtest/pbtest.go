@@ -0,0 +1,33 @@
+// Package pbtest provides constructors of Sysl pb values for the tests of the
+// gosysl packages.
+package pbtest
+
+import "github.com/anz-bank/gosysl/pb"
+
+// NewStringAttr returns a string attribute
+func NewStringAttr(s string) *pb.Attribute {
+	return &pb.Attribute{Attribute: &pb.Attribute_S{S: s}}
+}
+
+// NewLineType sets the source line of t and returns it
+func NewLineType(line int32, t *pb.Type) *pb.Type {
+	t.SourceContext = &pb.SourceContext{Start: &pb.SourceContext_Location{Line: line}}
+	return t
+}
+
+// NewPrimitiveType returns a primitive type defined at line
+func NewPrimitiveType(line int32, p pb.Type_Primitive) *pb.Type {
+	return NewLineType(line, &pb.Type{Type: &pb.Type_Primitive_{Primitive: p}})
+}
+
+// NewRefType returns a reference to the type name defined at line
+func NewRefType(line int32, name string) *pb.Type {
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Path: []string{name}}}
+	return NewLineType(line, &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}})
+}
+
+// NewTupleType returns a tuple type of the attribute definitions, without
+// source line
+func NewTupleType(attrDefs map[string]*pb.Type) *pb.Type {
+	return &pb.Type{Type: &pb.Type_Tuple_{Tuple: &pb.Type_Tuple{AttrDefs: attrDefs}}}
+}
@@ -0,0 +1,77 @@
+package gosysl
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// HasTypesFile reports whether the types of an application are generated into
+// their own file instead of the Storer file, set with the app attribute
+// types_file="true" or implied by a separate server package
+func HasTypesFile(app *pb.Application) bool {
+	return app.Attrs["types_file"].GetS() == "true" || hasServerPackage(app)
+}
+
+// GetServerPackage returns the package name and the import path of the shared
+// types package if the server files are generated into a separate package, set
+// with the app attribute types_import holding the import path of the generated
+// package. The server package is named "server" unless the app attribute
+// server_package is set.
+func GetServerPackage(app *pb.Application) (string, string, bool) {
+	if !hasServerPackage(app) {
+		return "", "", false
+	}
+	name := "server"
+	if attr, ok := app.Attrs["server_package"]; ok {
+		name = attr.GetS()
+	}
+	return name, app.Attrs["types_import"].GetS(), true
+}
+
+func hasServerPackage(app *pb.Application) bool {
+	return app.Attrs["types_import"].GetS() != ""
+}
+
+// WriteTypeAliases creates aliases in the server package for the types, the
+// Storer interface, MergePatch and Problem of the shared types package pkg, so
+// that the server files are generated as in a single package
+func WriteTypeAliases(w io.Writer, app *pb.Application, pkg string) error {
+	types, err := model.NewTypes(app)
+	if err != nil {
+		return err
+	}
+	optional, err := GetOptionalStrategy(app)
+	if err != nil {
+		return err
+	}
+	aliases := []string{getInterfaceName(app), "MergePatch", "Problem"}
+	for _, t := range types {
+		aliases = append(aliases, t.Name)
+	}
+	if optional == OptionalWrapper {
+		for _, typeStr := range getOptionalWrapped(types) {
+			aliases = append(aliases, GetOptionalWrapper(typeStr))
+		}
+	}
+	for _, name := range aliases {
+		fmt.Fprintf(w, "// %s is an alias of %s.%s.\n", name, pkg, name)
+		fmt.Fprintf(w, "type %s = %s.%s\n\n", name, pkg, name)
+		t := types.Get(name)
+		if t == nil || t.Kind != model.Enum {
+			continue
+		}
+		fmt.Fprintf(w, "// %s values\nconst (\n", name)
+		for _, item := range t.Items {
+			enumConst := GetEnumConst(name, item.Name)
+			fmt.Fprintf(w, "%s = %s.%s\n", enumConst, pkg, enumConst)
+		}
+		fmt.Fprint(w, ")\n\n")
+		fmt.Fprintf(w, "// Parse%s returns the %s value of a name.\n", name, name)
+		fmt.Fprintf(w, "func Parse%s(name string) (%s, error) {\n", name, name)
+		fmt.Fprintf(w, "return %s.Parse%s(name)\n}\n\n", pkg, name)
+	}
+	return nil
+}
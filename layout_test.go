@@ -0,0 +1,101 @@
+package gosysl
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	"github.com/golang/protobuf/proto"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestWriteTypeAliases(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := &pb.Application{
+		Types: map[string]*pb.Type{
+			"Data": pbtest.NewLineType(1, pbtest.NewTupleType(map[string]*pb.Type{
+				"Name": pbtest.NewPrimitiveType(1, pb.Type_STRING),
+			})),
+			"Status": newEnumType(2, map[string]int64{"ok": 1, "failed": 2}),
+		},
+	}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteTypeAliases(w, app, "api"))
+	expected := `// Storer is an alias of api.Storer.
+type Storer = api.Storer
+
+// MergePatch is an alias of api.MergePatch.
+type MergePatch = api.MergePatch
+
+// Problem is an alias of api.Problem.
+type Problem = api.Problem
+
+// Data is an alias of api.Data.
+type Data = api.Data
+
+// Status is an alias of api.Status.
+type Status = api.Status
+
+// Status values
+const (
+	StatusOk     = api.StatusOk
+	StatusFailed = api.StatusFailed
+)
+
+// ParseStatus returns the Status value of a name.
+func ParseStatus(name string) (Status, error) {
+	return api.ParseStatus(name)
+}
+
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(expected, string(actual))
+}
+
+func TestGenerateLayout(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+	data, err := ioutil.ReadFile("example/example.pb")
+	assert.NoError(err)
+	module := &pb.Module{}
+	assert.NoError(proto.Unmarshal(data, module))
+	app := module.Apps["RestApi"]
+
+	app.Attrs["types_file"] = pbtest.NewStringAttr("true")
+	assert.True(HasTypesFile(app))
+	_, _, separate := GetServerPackage(app)
+	assert.False(separate)
+	result, err := GenerateApp(app, "api")
+	assert.NoError(err)
+	assert.NotContains(string(result.Storer), "type Data struct {")
+	assert.Contains(string(result.Types), "package api\n")
+	assert.Contains(string(result.Types), "type Data struct {")
+	assert.NotContains(string(result.Types), "type MergePatch []byte")
+	assert.Contains(string(result.Rest), "type MergePatch []byte")
+	assert.Nil(result.ServerTypes)
+
+	delete(app.Attrs, "types_file")
+	app.Attrs["types_import"] = pbtest.NewStringAttr("example.com/svc/api")
+	assert.True(HasTypesFile(app))
+	serverPkg, typesImport, separate := GetServerPackage(app)
+	assert.Equal("server", serverPkg)
+	assert.Equal("example.com/svc/api", typesImport)
+	assert.True(separate)
+	app.Attrs["server_package"] = pbtest.NewStringAttr("handler")
+	result, err = GenerateApp(app, "api")
+	assert.NoError(err)
+	assert.Contains(string(result.Types), "type MergePatch []byte")
+	assert.Contains(string(result.Types), "type Problem struct {")
+	assert.Contains(string(result.Storer), "package api\n")
+	assert.Contains(string(result.Rest), "package handler\n")
+	assert.NotContains(string(result.Rest), "type MergePatch []byte")
+	assert.NotContains(string(result.Rest), `"reflect"`)
+	assert.Contains(string(result.Middleware), "package handler\n")
+	assert.Contains(string(result.ServerTypes), "package handler\n")
+	assert.Contains(string(result.ServerTypes), `api "example.com/svc/api"`)
+	assert.Contains(string(result.ServerTypes), "type Data = api.Data\n")
+}
@@ -0,0 +1,403 @@
+package gosysl
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// HasMemStorer reports whether an in-memory Storer is generated for an
+// application, set with the app attribute mem_storer="true"
+func HasMemStorer(app *pb.Application) bool {
+	return app.Attrs["mem_storer"].GetS() == "true"
+}
+
+// WriteMemStorer creates the methods of MemStorer implementing the interface
+// created by WriteInterface with JSON documents kept in memory per resource,
+// see getMemResource
+func WriteMemStorer(w io.Writer, app *pb.Application, epNames []string) error {
+	rs, err := getRoutes(app, epNames)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "var _ %s = (*MemStorer)(nil)\n\n", getInterfaceName(app))
+	for _, path := range rs.Paths {
+		for _, op := range path.Operations {
+			if err := writeMemStorerMethod(w, rs.API, op, HasContext(app)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// memStorerDocs describes what each method of MemStorer does with the document
+var memStorerDocs = map[string]string{
+	"GET":    "returns the document stored at",
+	"LIST":   "returns the documents stored at",
+	"IDS":    "returns the ids of the documents stored at",
+	"POST":   "stores the payload as document at",
+	"PUT":    "stores the payload as document at",
+	"PATCH":  "merges the payload into the document stored at",
+	"DELETE": "deletes the document stored at",
+}
+
+// memStorerFuncs holds the MemStorer helper called for each method
+var memStorerFuncs = map[string]string{
+	"GET":    "get",
+	"LIST":   "list",
+	"IDS":    "listIDs",
+	"POST":   "put",
+	"PUT":    "put",
+	"PATCH":  "patch",
+	"DELETE": "delete",
+}
+
+// memResource is the collection path of the documents accessed by an
+// operation and the path parameters identifying a document in it. Documents
+// created by POST are identified by the IDProperty of the payload in addition,
+// GET of a collection returns its documents, or their ids if ListIDs is set, in
+// the ListProperty of the result.
+type memResource struct {
+	Collection   string
+	Keys         []string
+	IDProperty   string
+	ListProperty string
+	ListIDs      bool
+}
+
+// getMemResource returns the resource of an operation. A path ending in a
+// parameter, e.g. /people/{id}, addresses a document in the collection
+// /people. POST to /people creates a document in the same collection with
+// the id taken from the payload's id property if the API has a path
+// /people/{id}. GET of /people returns the documents in the only property of
+// its result if it is a list of structs or unions, or their ids for a list of
+// strings. Other paths address a single document, GET of a collection path
+// without PUT is rejected as its document could not be stored.
+func getMemResource(api *model.API, op *model.Operation) (memResource, error) {
+	res := memResource{Collection: op.Path}
+	for _, p := range op.PathParams() {
+		res.Keys = append(res.Keys, p.Var)
+	}
+	if i := strings.LastIndex(op.Path, "/{"); i >= 0 && strings.HasSuffix(op.Path, "}") {
+		res.Collection = op.Path[:i]
+		return res, nil
+	}
+	idProperty := getMemIDProperty(api, op.Path)
+	if idProperty == "" {
+		return res, nil
+	}
+	switch op.Method {
+	case "POST":
+		res.IDProperty = idProperty
+	case "GET":
+		res.ListProperty, res.ListIDs = getMemListProperty(api.Types, op.Response.Type)
+		if res.ListProperty == "" && !hasMemPut(api, op.Path) {
+			format := "%s: MemStorer needs a result with a list to GET collection %s"
+			return res, fmt.Errorf(format, op.Name, op.Path)
+		}
+	}
+	return res, nil
+}
+
+// hasMemPut reports whether the API has a PUT operation on path
+func hasMemPut(api *model.API, path string) bool {
+	for _, p := range api.Paths {
+		if p.Path == path && p.Operation("PUT") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// getMemListProperty returns the JSON property of the only field of the named
+// struct type if it is a list of structs or unions, or of strings holding ids,
+// otherwise ""
+func getMemListProperty(types model.Types, name string) (string, bool) {
+	t := types.Get(name)
+	if t == nil || t.Kind != model.Struct || len(t.Fields) != 1 {
+		return "", false
+	}
+	switch f := t.Fields[0]; {
+	case f.Sysl.GetList() == nil:
+	case isValidated(types, f.GoType[2:]):
+		return f.JSON, false
+	case f.GoType == "[]string":
+		return f.JSON, true
+	}
+	return "", false
+}
+
+// getMemIDProperty returns the name of the parameter of a path /collection/{id}
+// of the API, or "" if path is not such a collection
+func getMemIDProperty(api *model.API, collection string) string {
+	for _, path := range api.Paths {
+		param := strings.TrimPrefix(path.Path, collection+"/")
+		if param != path.Path && param != "" && rePathParam.FindString(param) == param {
+			return param[1 : len(param)-1]
+		}
+	}
+	return ""
+}
+
+func writeMemStorerMethod(w io.Writer, api *model.API, op *model.Operation,
+	withContext bool) error {
+	res, err := getMemResource(api, op)
+	if err != nil {
+		return err
+	}
+	method := op.Method
+	if res.ListIDs {
+		method = "IDS"
+	} else if res.ListProperty != "" {
+		method = "LIST"
+	}
+	fmt.Fprintf(w, "// %s %s %s", op.Name, memStorerDocs[method], op.Path)
+	if res.IDProperty != "" {
+		fmt.Fprintf(w, "/{%s}, taking %s from the payload", res.IDProperty,
+			res.IDProperty)
+	}
+	fmt.Fprint(w, ".\n")
+	fmt.Fprintf(w, "func (ms *MemStorer) %s(%s) %s {\n", op.Name, getParams(op, withContext),
+		getReturnTypes(op))
+
+	args := []string{fmt.Sprintf("%q", res.Collection),
+		"memKey(" + strings.Join(res.Keys, ", ") + ")"}
+	helper := memStorerFuncs[method]
+	switch {
+	case res.IDProperty != "":
+		helper = "post"
+		args = append(args, fmt.Sprintf("%q", res.IDProperty))
+	case res.ListProperty != "":
+		args = append(args, fmt.Sprintf("%q", res.ListProperty))
+	}
+	if op.Method != "GET" && op.Method != "DELETE" {
+		payload := "nil"
+		if op.Payload != nil {
+			payload = op.Payload.Name
+		}
+		args = append(args, payload)
+	}
+	if op.Method == "PATCH" {
+		// the patched document is validated as value of the patched type
+		args = append(args, "new("+op.Payload.Type+")")
+	}
+	call := fmt.Sprintf("ms.%s(%s", helper, strings.Join(args, ", "))
+	if op.Response.Type == "" {
+		fmt.Fprintf(w, "return %s, nil)\n}\n\n", call)
+		return nil
+	}
+	fmt.Fprintf(w, "var result %s\n", op.Response.Type)
+	fmt.Fprintf(w, "err := %s, &result)\n", call)
+	fmt.Fprint(w, "return result, err\n}\n\n")
+	return nil
+}
+
+// getMemStorerImports returns the packages imported by the MemStorer file
+func getMemStorerImports(app *pb.Application, epNames []string) []string {
+	imports := []string{"encoding/json", "fmt", "net/http", "sort", "strconv", "strings",
+		"sync"}
+	if HasContext(app) {
+		imports = append([]string{"context"}, imports...)
+	}
+	if hasTimeParams(app, epNames) {
+		imports = append(imports, "time")
+	}
+	return imports
+}
+
+const memStorerPrefix = `// MemStorer is a Storer keeping JSON documents in memory.
+// It holds the last document stored per collection path and id, is safe for
+// concurrent use and returns documents decoded into the result type of a
+// method.
+type MemStorer struct {
+	mu   sync.RWMutex
+	docs map[string]map[string][]byte
+}
+
+// NewMemStorer creates a new empty MemStorer.
+func NewMemStorer() *MemStorer {
+	return &MemStorer{docs: map[string]map[string][]byte{}}
+}
+
+// MemNotFoundError is returned by MemStorer if no document is stored in a
+// collection for given key, it implements StatusError.
+type MemNotFoundError struct {
+	Path string
+	Key  string
+}
+
+func (e *MemNotFoundError) Error() string {
+	return fmt.Sprintf("no document at %s for '%s'", e.Path, e.Key)
+}
+
+// Status returns http.StatusNotFound.
+func (e *MemNotFoundError) Status() int {
+	return http.StatusNotFound
+}
+
+// memKey joins path parameter values to the key of a document
+func memKey(values ...interface{}) string {
+	keys := make([]string, len(values))
+	for i, v := range values {
+		keys[i] = fmt.Sprint(v)
+	}
+	return strings.Join(keys, "/")
+}
+
+func (ms *MemStorer) get(path, key string, result interface{}) error {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	doc, ok := ms.docs[path][key]
+	if !ok {
+		return &MemNotFoundError{path, key}
+	}
+	return decodeDoc(doc, result)
+}
+
+// list decodes the documents in path whose key extends key, ordered by key,
+// into the JSON array property of result.
+func (ms *MemStorer) list(path, key, property string, result interface{}) error {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	docs := []json.RawMessage{}
+	for _, k := range ms.keys(path, key) {
+		docs = append(docs, ms.docs[path][k])
+	}
+	return decodeList(property, docs, result)
+}
+
+// listIDs decodes the ids of the documents in path whose key extends key,
+// ordered by key, into the JSON array property of result.
+func (ms *MemStorer) listIDs(path, key, property string, result interface{}) error {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	ids := []string{}
+	for _, k := range ms.keys(path, key) {
+		ids = append(ids, strings.TrimPrefix(k, key+"/"))
+	}
+	return decodeList(property, ids, result)
+}
+
+// keys returns the sorted keys of the documents in path extending key, the
+// caller holds the lock.
+func (ms *MemStorer) keys(path, key string) []string {
+	var keys []string
+	for k := range ms.docs[path] {
+		if key == "" && k != "" || strings.HasPrefix(k, key+"/") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (ms *MemStorer) put(path, key string, payload, result interface{}) error {
+	doc, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.store(path, key, doc, result)
+}
+
+// post stores the payload as document in path with key extended by the
+// payload's id property, or by a new id if the payload has none.
+func (ms *MemStorer) post(path, key, idProperty string,
+	payload, result interface{}) error {
+	doc, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		key += "/"
+	}
+	var fields map[string]interface{}
+	d := json.NewDecoder(strings.NewReader(string(doc)))
+	d.UseNumber()
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if err := d.Decode(&fields); err == nil && fields[idProperty] != nil {
+		key += fmt.Sprint(fields[idProperty])
+	} else {
+		key += ms.newID(path, key)
+	}
+	return ms.store(path, key, doc, result)
+}
+
+// newID returns an id not used by the documents with key prefix in path,
+// counting up from the number of documents in path.
+func (ms *MemStorer) newID(path, prefix string) string {
+	for n := len(ms.docs[path]) + 1; ; n++ {
+		id := strconv.Itoa(n)
+		if _, ok := ms.docs[path][prefix+id]; !ok {
+			return id
+		}
+	}
+}
+
+// patch applies the merge patch to the document at key in path decoded into
+// doc and stores the patched document unless it is invalid.
+func (ms *MemStorer) patch(path, key string, patch MergePatch,
+	doc, result interface{}) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	stored, ok := ms.docs[path][key]
+	if !ok {
+		return &MemNotFoundError{path, key}
+	}
+	if err := json.Unmarshal(stored, doc); err != nil {
+		return err
+	}
+	if err := patch.Apply(doc); err != nil {
+		return err
+	}
+	patched, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return ms.store(path, key, patched, result)
+}
+
+func (ms *MemStorer) delete(path, key string, result interface{}) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	doc, ok := ms.docs[path][key]
+	if !ok {
+		return &MemNotFoundError{path, key}
+	}
+	delete(ms.docs[path], key)
+	return decodeDoc(doc, result)
+}
+
+// store stores doc at key in path, the caller holds the write lock.
+func (ms *MemStorer) store(path, key string, doc []byte, result interface{}) error {
+	if ms.docs[path] == nil {
+		ms.docs[path] = map[string][]byte{}
+	}
+	ms.docs[path][key] = doc
+	return decodeDoc(doc, result)
+}
+
+// decodeList decodes the JSON object with the list of values in property into
+// result.
+func decodeList(property string, values interface{}, result interface{}) error {
+	doc, err := json.Marshal(map[string]interface{}{property: values})
+	if err != nil {
+		return err
+	}
+	return decodeDoc(doc, result)
+}
+
+// decodeDoc decodes a stored document into result unless result is nil.
+func decodeDoc(doc []byte, result interface{}) error {
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(doc, result)
+}
+`
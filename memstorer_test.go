@@ -0,0 +1,220 @@
+package gosysl
+
+import (
+	"bytes"
+	"go/format"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+	"github.com/golang/protobuf/proto"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestWriteMemStorer(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := newPatchEndpoint()
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Data"}}}
+	noRet := &pb.Statement{Stmt: &pb.Statement_Action{Action: &pb.Action{Action: "return"}}}
+	get := &pb.Endpoint{Name: "GET /api/{key}", RestParams: ep.RestParams}
+	get.Stmt = []*pb.Statement{ret}
+	del := &pb.Endpoint{Name: "DELETE /api/{key}", RestParams: ep.RestParams}
+	del.Stmt = []*pb.Statement{noRet}
+	post := &pb.Endpoint{Name: "POST /api", Param: ep.Param, Stmt: get.Stmt}
+	app := &pb.Application{
+		Attrs: map[string]*pb.Attribute{"mem_storer": pbtest.NewStringAttr("true")},
+		Endpoints: map[string]*pb.Endpoint{
+			ep.Name: ep, get.Name: get, del.Name: del, post.Name: post,
+		},
+	}
+	assert.True(HasMemStorer(app))
+	w := &bytes.Buffer{}
+	epNames := []string{get.Name, ep.Name, del.Name, post.Name}
+	assert.NoError(WriteMemStorer(w, app, epNames))
+	expected := `var _ Storer = (*MemStorer)(nil)
+
+// GetApiKey returns the document stored at /api/{key}.
+func (ms *MemStorer) GetApiKey(key string) (Data, error) {
+	var result Data
+	err := ms.get("/api", memKey(key), &result)
+	return result, err
+}
+
+// PatchApiKey merges the payload into the document stored at /api/{key}.
+func (ms *MemStorer) PatchApiKey(key string, dp MergePatch) (Data, error) {
+	var result Data
+	err := ms.patch("/api", memKey(key), dp, new(DataPayload), &result)
+	return result, err
+}
+
+// DeleteApiKey deletes the document stored at /api/{key}.
+func (ms *MemStorer) DeleteApiKey(key string) error {
+	return ms.delete("/api", memKey(key), nil)
+}
+
+// PostApi stores the payload as document at /api/{key}, taking key from the payload.
+func (ms *MemStorer) PostApi(dp DataPayload) (Data, error) {
+	var result Data
+	err := ms.post("/api", memKey(), "key", dp, &result)
+	return result, err
+}
+
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(expected, string(actual))
+
+	imports := getMemStorerImports(app, []string{get.Name})
+	assert.Equal([]string{"encoding/json", "fmt", "net/http", "sort", "strconv", "strings",
+		"sync"}, imports)
+
+	result, err := GenerateApp(app, "mem")
+	assert.NoError(err)
+	assert.Contains(string(result.MemStorer), "func NewMemStorer() *MemStorer {")
+
+	res, err := getMemResource(&model.API{}, &model.Operation{Method: "POST", Path: "/api"})
+	assert.NoError(err)
+	assert.Equal(memResource{"/api", nil, "", "", false}, res)
+
+	// collections without PUT can only be listed
+	list := &pb.Endpoint{Name: "GET /api", Stmt: get.Stmt}
+	app.Endpoints[list.Name] = list
+	_, err = GenerateApp(app, "mem")
+	assert.EqualError(err, "GetApi: MemStorer needs a result with a list to GET "+
+		"collection /api")
+
+	// ids are listed into lists of strings
+	data, err := ioutil.ReadFile("example/example.pb")
+	assert.NoError(err)
+	module := &pb.Module{}
+	assert.NoError(proto.Unmarshal(data, module))
+	example := module.Apps["RestApi"]
+	example.Attrs["mem_storer"] = pbtest.NewStringAttr("true")
+	result, err = GenerateApp(example, "mem")
+	assert.NoError(err)
+	expected = `// GetKeys returns the ids of the documents stored at /api.
+func (ms *MemStorer) GetKeys() (Keys, error) {
+	var result Keys
+	err := ms.listIDs("/api", memKey(), "keys", &result)
+	return result, err
+}
+`
+	assert.Contains(string(result.MemStorer), expected)
+
+	app.Attrs = nil
+	assert.False(HasMemStorer(app))
+	result, err = GenerateApp(app, "mem")
+	assert.NoError(err)
+	assert.Nil(result.MemStorer)
+}
+
+func TestMemStorerPostGet(tt *testing.T) {
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Person"}}}
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Appname: &pb.AppName{Part: []string{"Person"}}}}
+	param := &pb.Param{Name: "p", Type: &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}}}
+	id := &pb.Endpoint_RestParams_QueryParam{Name: "id",
+		Type: pbtest.NewPrimitiveType(1, pb.Type_INT)}
+	restParams := &pb.Endpoint_RestParams{
+		QueryParam: []*pb.Endpoint_RestParams_QueryParam{id},
+	}
+	post := &pb.Endpoint{Name: "POST /people", Param: []*pb.Param{param},
+		Stmt: []*pb.Statement{ret}}
+	get := &pb.Endpoint{Name: "GET /people/{id}", Stmt: []*pb.Statement{ret},
+		RestParams: restParams}
+	patch := &pb.Endpoint{Name: "PATCH /people/{id}", Param: []*pb.Param{param},
+		Stmt: []*pb.Statement{ret}, RestParams: restParams}
+	retList := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "People"}}}
+	list := &pb.Endpoint{Name: "GET /people", Stmt: []*pb.Statement{retList}}
+	personID := pbtest.NewPrimitiveType(1, pb.Type_INT)
+	personID.Opt = true
+	name := pbtest.NewPrimitiveType(2, pb.Type_STRING)
+	length := &pb.Type_Constraint_Length{Min: 1, Max: 10}
+	name.Constraint = []*pb.Type_Constraint{{Length: length}}
+	items := &pb.Type_List{Type: pbtest.NewRefType(3, "Person")}
+	app := &pb.Application{
+		Attrs: map[string]*pb.Attribute{
+			"mem_storer":              pbtest.NewStringAttr("true"),
+			"router":                  pbtest.NewStringAttr(RouterServeMux),
+			"json_property_separator": pbtest.NewStringAttr("_"),
+		},
+		Endpoints: map[string]*pb.Endpoint{
+			post.Name: post, get.Name: get, patch.Name: patch, list.Name: list,
+		},
+		Types: map[string]*pb.Type{
+			"Person": pbtest.NewLineType(1, pbtest.NewTupleType(map[string]*pb.Type{
+				"Id":   personID,
+				"Name": name,
+			})),
+			"People": pbtest.NewLineType(3, pbtest.NewTupleType(map[string]*pb.Type{
+				"Items": pbtest.NewLineType(3, &pb.Type{Type: &pb.Type_List_{List: items}}),
+			})),
+		},
+	}
+	runGenerated(tt, app, memStorerPostGetTest)
+}
+
+const memStorerPostGetTest = `package gen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type middleware struct{}
+
+func (middleware) Root() []func(http.Handler) http.Handler { return nil }
+
+func serve(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w
+}
+
+func TestPostGet(t *testing.T) {
+	h := NewRestHandler(NewMemStorer(), middleware{})
+	// payloads without id get a new one instead of overwriting a document
+	bodies := []string{
+		` + "`" + `{"id": 1, "name": "Tom"}` + "`" + `,
+		` + "`" + `{"id": 2, "name": "Jerry"}` + "`" + `,
+		` + "`" + `{"name": "Spike"}` + "`" + `,
+		` + "`" + `{"name": "Tyke"}` + "`" + `,
+	}
+	for _, body := range bodies {
+		if w := serve(&h, "POST", "/people", body); w.Code != http.StatusCreated {
+			t.Fatalf("unexpected status %d: %s", w.Code, w.Body)
+		}
+	}
+	w := serve(&h, "GET", "/people", "")
+	expected := ` + "`" + `{"items":[{"id":1,"name":"Tom"},{"id":2,"name":"Jerry"},` +
+	`{"name":"Spike"},{"name":"Tyke"}]}` + "`" + `
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != expected {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body)
+	}
+	w = serve(&h, "GET", "/people/3", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Spike") {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body)
+	}
+	if w := serve(&h, "GET", "/people/5", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unexpected status %d", w.Code)
+	}
+
+	// invalid patched documents are not stored
+	w = serve(&h, "PATCH", "/people/1", ` + "`" + `{"name": ""}` + "`" + `)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_") {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body)
+	}
+	w = serve(&h, "PATCH", "/people/1", ` + "`" + `{"name": "Thomas"}` + "`" + `)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Thomas") {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body)
+	}
+	w = serve(&h, "GET", "/people/1", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Thomas") {
+		t.Errorf("unexpected response %d: %s", w.Code, w.Body)
+	}
+}
+`
@@ -0,0 +1,177 @@
+package gosysl
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// HasMocks reports whether mocks of the Storer and Middleware interfaces are
+// generated for an application, set with the app attribute mocks="true"
+func HasMocks(app *pb.Application) bool {
+	return app.Attrs["mocks"].GetS() == "true"
+}
+
+// WriteMocks creates MockStorer and MockMiddleware implementing the interfaces
+// created by WriteInterface and WriteMiddleware. Every mocked method records
+// its call and delegates to the function field named after the method with
+// suffix Func, if set.
+func WriteMocks(w io.Writer, app *pb.Application, epNames []string) error {
+	api, err := model.New(app, epNames)
+	if err != nil {
+		return err
+	}
+	interfaceName := getInterfaceName(app)
+	mockName := "Mock" + interfaceName
+	fmt.Fprintf(w, "// %s is a mock %s, set the <Method>Func fields to\n", mockName,
+		interfaceName)
+	fmt.Fprintln(w, "// implement methods, unset methods fail with UnexpectedCallError.")
+	fmt.Fprintf(w, "type %s struct {\nMock\n", mockName)
+	for _, op := range api.Operations {
+		_, types := getParamDefs(op, HasContext(app))
+		funcType := fmt.Sprintf("func(%s) %s", strings.Join(types, ", "), getReturnTypes(op))
+		fmt.Fprintf(w, "%sFunc %s\n", op.Name, funcType)
+	}
+	fmt.Fprintf(w, "}\n\nvar _ %s = (*%s)(nil)\n\n", interfaceName, mockName)
+	for _, op := range api.Operations {
+		writeMockMethod(w, mockName, op, HasContext(app))
+	}
+
+	middlewares := append(api.Middleware, "Root")
+	fmt.Fprintln(w, "// MockMiddleware is a mock Middleware, set the <Method>Func fields to")
+	fmt.Fprintln(w, "// return middleware, unset methods return no middleware.")
+	fmt.Fprint(w, "type MockMiddleware struct {\nMock\n")
+	for _, m := range middlewares {
+		fmt.Fprintf(w, "%sFunc func() []func(next http.Handler) http.Handler\n", m)
+	}
+	fmt.Fprint(w, "}\n\nvar _ Middleware = (*MockMiddleware)(nil)\n\n")
+	for _, m := range middlewares {
+		fmt.Fprintf(w, "// %s records the call and returns the result of %sFunc.\n", m, m)
+		format := "func (m *MockMiddleware) %s() []func(next http.Handler) http.Handler {\n"
+		fmt.Fprintf(w, format, m)
+		fmt.Fprintf(w, "m.record(\"%s\")\nif m.%sFunc == nil {\nreturn nil\n}\n", m, m)
+		fmt.Fprintf(w, "return m.%sFunc()\n}\n\n", m)
+	}
+	return nil
+}
+
+func writeMockMethod(w io.Writer, mockName string, op *model.Operation,
+	withContext bool) {
+	name := op.Name
+	names, _ := getParamDefs(op, withContext)
+	params, returnTypes := getParams(op, withContext), getReturnTypes(op)
+	retType := op.Response.Type
+	args := strings.Join(names, ", ")
+	fmt.Fprintf(w, "// %s records the call and returns the result of %sFunc.\n", name, name)
+	fmt.Fprintf(w, "func (mock *%s) %s(%s) %s {\n", mockName, name, params, returnTypes)
+	recordArgs := append([]string{`"` + name + `"`}, names...)
+	fmt.Fprintf(w, "mock.record(%s)\n", strings.Join(recordArgs, ", "))
+	fmt.Fprintf(w, "if mock.%sFunc == nil {\n", name)
+	if retType == "" {
+		fmt.Fprintf(w, "return &UnexpectedCallError{\"%s\"}\n}\n", name)
+	} else {
+		fmt.Fprintf(w, "var result %s\n", retType)
+		fmt.Fprintf(w, "return result, &UnexpectedCallError{\"%s\"}\n}\n", name)
+	}
+	fmt.Fprintf(w, "return mock.%sFunc(%s)\n}\n\n", name, args)
+}
+
+// getMocksImports returns the packages imported by the mocks file
+func getMocksImports(app *pb.Application, epNames []string) []string {
+	imports := []string{"net/http", "reflect", "sync"}
+	if HasContext(app) {
+		imports = append([]string{"context"}, imports...)
+	}
+	if hasTimeParams(app, epNames) {
+		imports = append(imports, "time")
+	}
+	return imports
+}
+
+const mocksPrefix = `// MockCall holds the method name and arguments of a mocked call.
+type MockCall struct {
+	Method string
+	Args   []interface{}
+}
+
+// Mock records the calls of mocked methods, it is safe for concurrent use.
+type Mock struct {
+	mu    sync.Mutex
+	calls []MockCall
+}
+
+func (m *Mock) record(method string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, MockCall{method, args})
+}
+
+// Calls returns the recorded calls of method, or all calls if method is "".
+func (m *Mock) Calls(method string) []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []MockCall
+	for _, c := range m.calls {
+		if method == "" || c.Method == method {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// MockT is the part of testing.TB used by the Mock assertions.
+type MockT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertCalled checks that method was called with args.
+func (m *Mock) AssertCalled(t MockT, method string, args ...interface{}) bool {
+	t.Helper()
+	for _, c := range m.Calls(method) {
+		if reflect.DeepEqual(c.Args, args) {
+			return true
+		}
+	}
+	t.Errorf("%s not called with %v, calls: %v", method, args, m.Calls(method))
+	return false
+}
+
+// AssertNotCalled checks that method was not called.
+func (m *Mock) AssertNotCalled(t MockT, method string) bool {
+	t.Helper()
+	if calls := m.Calls(method); len(calls) > 0 {
+		t.Errorf("%s called %d times, calls: %v", method, len(calls), calls)
+		return false
+	}
+	return true
+}
+
+// AssertNumberOfCalls checks that method was called n times.
+func (m *Mock) AssertNumberOfCalls(t MockT, method string, n int) bool {
+	t.Helper()
+	if calls := m.Calls(method); len(calls) != n {
+		t.Errorf("%s called %d times, expected %d times", method, len(calls), n)
+		return false
+	}
+	return true
+}
+
+// UnexpectedCallError is returned by mocked methods without function, it
+// implements StatusError.
+type UnexpectedCallError struct {
+	Method string
+}
+
+func (e *UnexpectedCallError) Error() string {
+	return "unexpected call of " + e.Method
+}
+
+// Status returns http.StatusNotImplemented.
+func (e *UnexpectedCallError) Status() int {
+	return http.StatusNotImplemented
+}
+`
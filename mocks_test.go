@@ -0,0 +1,101 @@
+package gosysl
+
+import (
+	"bytes"
+	"go/format"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestWriteMocks(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := newPatchEndpoint()
+	ep.Attrs = map[string]*pb.Attribute{"middleware": pbtest.NewStringAttr("Authorize")}
+	noRet := &pb.Statement{Stmt: &pb.Statement_Action{Action: &pb.Action{Action: "return"}}}
+	del := &pb.Endpoint{Name: "DELETE /api/{key}", RestParams: ep.RestParams}
+	del.Stmt = []*pb.Statement{noRet}
+	app := &pb.Application{
+		Attrs: map[string]*pb.Attribute{"mocks": pbtest.NewStringAttr("true")},
+		Endpoints: map[string]*pb.Endpoint{
+			ep.Name: ep, del.Name: del,
+		},
+	}
+	assert.True(HasMocks(app))
+	w := &bytes.Buffer{}
+	assert.NoError(WriteMocks(w, app, []string{ep.Name, del.Name}))
+	expected := `// MockStorer is a mock Storer, set the <Method>Func fields to
+// implement methods, unset methods fail with UnexpectedCallError.
+type MockStorer struct {
+	Mock
+	PatchApiKeyFunc  func(string, MergePatch) (Data, error)
+	DeleteApiKeyFunc func(string) error
+}
+
+var _ Storer = (*MockStorer)(nil)
+
+// PatchApiKey records the call and returns the result of PatchApiKeyFunc.
+func (mock *MockStorer) PatchApiKey(key string, dp MergePatch) (Data, error) {
+	mock.record("PatchApiKey", key, dp)
+	if mock.PatchApiKeyFunc == nil {
+		var result Data
+		return result, &UnexpectedCallError{"PatchApiKey"}
+	}
+	return mock.PatchApiKeyFunc(key, dp)
+}
+
+// DeleteApiKey records the call and returns the result of DeleteApiKeyFunc.
+func (mock *MockStorer) DeleteApiKey(key string) error {
+	mock.record("DeleteApiKey", key)
+	if mock.DeleteApiKeyFunc == nil {
+		return &UnexpectedCallError{"DeleteApiKey"}
+	}
+	return mock.DeleteApiKeyFunc(key)
+}
+
+// MockMiddleware is a mock Middleware, set the <Method>Func fields to
+// return middleware, unset methods return no middleware.
+type MockMiddleware struct {
+	Mock
+	AuthorizeFunc func() []func(next http.Handler) http.Handler
+	RootFunc      func() []func(next http.Handler) http.Handler
+}
+
+var _ Middleware = (*MockMiddleware)(nil)
+
+// Authorize records the call and returns the result of AuthorizeFunc.
+func (m *MockMiddleware) Authorize() []func(next http.Handler) http.Handler {
+	m.record("Authorize")
+	if m.AuthorizeFunc == nil {
+		return nil
+	}
+	return m.AuthorizeFunc()
+}
+
+// Root records the call and returns the result of RootFunc.
+func (m *MockMiddleware) Root() []func(next http.Handler) http.Handler {
+	m.record("Root")
+	if m.RootFunc == nil {
+		return nil
+	}
+	return m.RootFunc()
+}
+
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(expected, string(actual))
+
+	result, err := GenerateApp(app, "mocks")
+	assert.NoError(err)
+	assert.Contains(string(result.Mocks), "func (m *Mock) AssertCalled(")
+
+	app.Attrs = nil
+	assert.False(HasMocks(app))
+	result, err = GenerateApp(app, "mocks")
+	assert.NoError(err)
+	assert.Nil(result.Mocks)
+}
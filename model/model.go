@@ -0,0 +1,378 @@
+// Package model interprets a Sysl application as REST API. It turns a
+// pb.Application into operations with their parameters, payloads and responses
+// and into named types, the model the gosysl generators write code from.
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// Methods holds the supported HTTP methods in the order operations of a path
+// are listed
+var Methods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// API is the model of the REST endpoints and types of a Sysl application
+type API struct {
+	// Paths holds the paths in order of their first operation
+	Paths []*Path
+	// Operations holds an operation per endpoint in the given order
+	Operations []*Operation
+	// Middleware holds the distinct middleware of the operations in order of
+	// first use
+	Middleware []string
+	Types      Types
+}
+
+// Path is a path with its operations in Methods order. Path parameters and
+// middleware are taken from its first operation.
+type Path struct {
+	Path       string
+	Middleware string
+	PathParams []*Param
+	Operations []*Operation
+}
+
+// Operation is an HTTP method on a path served by a method of the Storer
+// interface
+type Operation struct {
+	// Name is the name of the Storer method
+	Name       string
+	Doc        string
+	Method     string
+	Path       string
+	Middleware string
+	// Params holds the path, query, header and cookie parameters in the order
+	// of the Storer method arguments
+	Params []*Param
+	// Payload is the request body, nil if there is none
+	Payload *Payload
+	// Response is the successful response
+	Response Response
+	// ErrorStatuses holds the documented error statuses
+	ErrorStatuses []int
+	Endpoint      *pb.Endpoint
+}
+
+// Payload is the request body of an operation, the last argument of the
+// Storer method
+type Payload struct {
+	// Name is the name of the Storer method parameter
+	Name string
+	// Type is the type referenced by the parameter, "" if there is none
+	Type string
+	// MergePatch reports whether the payload is a JSON merge patch of Type
+	MergePatch bool
+}
+
+// Response is the successful response of an operation
+type Response struct {
+	Status int
+	// Type is the type of the response body, "" if there is none
+	Type string
+}
+
+// New creates the model of the endpoints epNames and the types of an
+// application
+func New(app *pb.Application, epNames []string) (*API, error) {
+	api := &API{Operations: make([]*Operation, 0, len(epNames))}
+	paths := make(map[string]*Path, len(epNames))
+	for _, name := range epNames {
+		op, err := NewOperation(app, name)
+		if err != nil {
+			return nil, err
+		}
+		api.Operations = append(api.Operations, op)
+		path, ok := paths[op.Path]
+		if !ok {
+			path = &Path{
+				Path:       op.Path,
+				Middleware: op.Middleware,
+				PathParams: op.PathParams(),
+			}
+			paths[op.Path] = path
+			api.Paths = append(api.Paths, path)
+		}
+		path.add(op)
+	}
+	api.Middleware = GetMiddleware(app, epNames)
+	types, err := NewTypes(app)
+	if err != nil {
+		return nil, err
+	}
+	api.Types = types
+	return api, nil
+}
+
+// Path returns the path of the API with given pattern, nil if there is none
+func (a *API) Path(path string) *Path {
+	for _, p := range a.Paths {
+		if p.Path == path {
+			return p
+		}
+	}
+	return nil
+}
+
+// add inserts an operation in Methods order, replacing one of the same method
+func (p *Path) add(op *Operation) {
+	for i, o := range p.Operations {
+		switch {
+		case o.Method == op.Method:
+			p.Operations[i] = op
+			return
+		case methodIndex(o.Method) > methodIndex(op.Method):
+			p.Operations = append(p.Operations[:i],
+				append([]*Operation{op}, p.Operations[i:]...)...)
+			return
+		}
+	}
+	p.Operations = append(p.Operations, op)
+}
+
+func methodIndex(method string) int {
+	for i, m := range Methods {
+		if m == method {
+			return i
+		}
+	}
+	return len(Methods)
+}
+
+// Operation returns the operation of a method, nil if there is none
+func (p *Path) Operation(method string) *Operation {
+	for _, op := range p.Operations {
+		if op.Method == method {
+			return op
+		}
+	}
+	return nil
+}
+
+// NewOperation creates the operation of the endpoint name of an application,
+// which has to be named "METHOD path"
+func NewOperation(app *pb.Application, name string) (*Operation, error) {
+	fields := strings.Split(name, " ")
+	if len(fields) != 2 {
+		msg := `expect "GET|POST|etc path/path" as endpoint name (%s) `
+		return nil, fmt.Errorf(msg, name)
+	}
+	method := strings.ToUpper(fields[0])
+	if methodIndex(method) == len(Methods) {
+		return nil, fmt.Errorf("invalid HTTP Method (%s)", method)
+	}
+	ep, ok := app.Endpoints[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint (%s)", name)
+	}
+	params, err := GetParams(ep)
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string, len(params)+1)
+	for _, p := range params {
+		if err := checkParam(app, p); err != nil {
+			return nil, err
+		}
+		if other, ok := vars[p.Var]; ok {
+			return nil, fmt.Errorf("parameters %s and %s of %s have the same variable %s",
+				other, p.Name, name, p.Var)
+		}
+		vars[p.Var] = p.Name
+	}
+	result, err := GetResultType(ep)
+	if err != nil {
+		return nil, err
+	}
+	status, err := GetSuccessStatus(ep, method, result)
+	if err != nil {
+		return nil, err
+	}
+	errStatuses, err := GetErrorStatuses(ep)
+	if err != nil {
+		return nil, err
+	}
+	payload := GetPayload(ep)
+	if method == "PATCH" && (payload == nil || payload.Type == "") {
+		return nil, fmt.Errorf("missing merge patch payload in (%s)", name)
+	}
+	if payload != nil && vars[payload.Name] != "" {
+		return nil, fmt.Errorf("parameter %s and the payload of %s have the same "+
+			"variable %s", vars[payload.Name], name, payload.Name)
+	}
+	return &Operation{
+		Name:          GetMethodName(ep),
+		Doc:           ep.Attrs["method_doc"].GetS(),
+		Method:        method,
+		Path:          fields[1],
+		Middleware:    ep.Attrs["middleware"].GetS(),
+		Params:        params,
+		Payload:       payload,
+		Response:      Response{status, result},
+		ErrorStatuses: errStatuses,
+		Endpoint:      ep,
+	}, nil
+}
+
+// PathParams returns the path parameters of an operation
+func (o *Operation) PathParams() []*Param {
+	return o.paramsIn(InPath)
+}
+
+// RequestParams returns the query, header and cookie parameters of an
+// operation
+func (o *Operation) RequestParams() []*Param {
+	return o.paramsIn(InQuery, InHeader, InCookie)
+}
+
+func (o *Operation) paramsIn(locations ...string) []*Param {
+	var result []*Param
+	for _, p := range o.Params {
+		for _, in := range locations {
+			if p.In == in {
+				result = append(result, p)
+			}
+		}
+	}
+	return result
+}
+
+// HasBody reports whether the handler of an operation decodes a request body,
+// which POST, PUT and PATCH handlers do
+func (o *Operation) HasBody() bool {
+	return o.Method == "POST" || o.Method == "PUT" || o.Method == "PATCH"
+}
+
+// GoType returns the Go type of the payload parameter of the Storer method
+func (p *Payload) GoType() string {
+	if p.MergePatch {
+		return "MergePatch"
+	}
+	return p.Type
+}
+
+// GetPayload returns the payload of an endpoint, nil if it has no parameter
+func GetPayload(ep *pb.Endpoint) *Payload {
+	if len(ep.GetParam()) == 0 {
+		return nil
+	}
+	payload := &Payload{
+		Name:       getSafeVarName(ep.Param[0].Name),
+		MergePatch: strings.HasPrefix(strings.ToUpper(ep.Name), "PATCH "),
+	}
+	if ref := ep.Param[0].Type.GetTypeRef(); ref != nil {
+		payload.Type = ref.Ref.Appname.Part[0]
+	}
+	return payload
+}
+
+// GetResultType returns the type of the value returned by an endpoint, or ""
+// if the endpoint only returns an error
+func GetResultType(ep *pb.Endpoint) (string, error) {
+	for _, s := range ep.Stmt {
+		if s.GetAction() != nil && s.GetAction().GetAction() == "return" {
+			// simple return type without value
+			return "", nil
+		}
+		if s.GetRet() != nil {
+			return s.GetRet().GetPayload(), nil
+		}
+	}
+	return "", fmt.Errorf("return missing in endpoint %s", ep.String())
+}
+
+var reMethodRemove = regexp.MustCompile(`[{}\s]`)
+var reMethodSeparate = regexp.MustCompile(`[._,#-]`)
+
+// GetMethodName returns the name of the Storer method of an endpoint, set
+// with the attribute method_name or created from the endpoint name
+func GetMethodName(ep *pb.Endpoint) string {
+	if n, ok := ep.Attrs["method_name"]; ok {
+		return n.GetS()
+	}
+	name := reMethodRemove.ReplaceAllLiteralString(ep.Name, "")
+	name = reMethodSeparate.ReplaceAllLiteralString(name, "/")
+
+	fields := strings.Split(name, "/")
+	for i, field := range fields {
+		fields[i] = strings.Title(strings.ToLower(field))
+	}
+	return strings.Join(fields, "")
+}
+
+// GetMiddleware returns the distinct middleware attributes of endpoints in
+// order of first use
+func GetMiddleware(app *pb.Application, epNames []string) []string {
+	middlewares := make([]string, 0, len(epNames))
+	middlewareSet := make(map[string]struct{}, len(epNames))
+	for _, name := range epNames {
+		if m, ok := app.Endpoints[name].GetAttrs()["middleware"]; ok {
+			if _, ok2 := middlewareSet[m.GetS()]; !ok2 {
+				middlewareSet[m.GetS()] = struct{}{}
+				middlewares = append(middlewares, m.GetS())
+			}
+		}
+	}
+	return middlewares
+}
+
+// GetSuccessStatus returns the status code of successful responses of an
+// endpoint, set with the attribute status or 201 Created for POST, 204 No
+// Content for endpoints without result and 200 OK otherwise by default
+func GetSuccessStatus(ep *pb.Endpoint, method, result string) (int, error) {
+	if attr, ok := ep.Attrs["status"]; ok {
+		status, err := getStatusAttr(attr)
+		if err != nil || status < 200 || status > 299 {
+			return 0, fmt.Errorf("invalid success status of %s, expect 2xx", ep.Name)
+		}
+		if result != "" && (status == http.StatusNoContent ||
+			status == http.StatusResetContent) {
+			return 0, fmt.Errorf("success status %d of %s cannot have a result", status,
+				ep.Name)
+		}
+		return status, nil
+	}
+	switch {
+	case method == "POST":
+		return http.StatusCreated, nil
+	case result == "":
+		return http.StatusNoContent, nil
+	}
+	return http.StatusOK, nil
+}
+
+// GetErrorStatuses returns the documented error status codes of an endpoint
+// listed in the attribute error_status, e.g. "404, 409"
+func GetErrorStatuses(ep *pb.Endpoint) ([]int, error) {
+	attr, ok := ep.Attrs["error_status"]
+	if !ok {
+		return nil, nil
+	}
+	values := getAttrList(attr)
+	if _, ok := attr.GetAttribute().(*pb.Attribute_I); ok {
+		values = []string{strconv.FormatInt(attr.GetI(), 10)}
+	}
+	result := make([]int, 0, len(values))
+	for _, v := range values {
+		status, err := strconv.Atoi(v)
+		if err != nil || status < 400 || status > 599 {
+			return nil, fmt.Errorf("invalid error status '%s' of %s, expect 4xx or 5xx",
+				v, ep.Name)
+		}
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// getStatusAttr returns the status code of an integer or string attribute
+func getStatusAttr(attr *pb.Attribute) (int, error) {
+	if _, ok := attr.GetAttribute().(*pb.Attribute_I); ok {
+		return int(attr.GetI()), nil
+	}
+	return strconv.Atoi(strings.TrimSpace(attr.GetS()))
+}
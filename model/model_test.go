@@ -0,0 +1,188 @@
+package model
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	"github.com/golang/protobuf/proto"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func newExampleApp(tt *testing.T) *pb.Application {
+	data, err := ioutil.ReadFile("../example/example.pb")
+	testifyAssert.NoError(tt, err)
+	module := &pb.Module{}
+	testifyAssert.NoError(tt, proto.Unmarshal(data, module))
+	return module.Apps["RestApi"]
+}
+
+func TestNew(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := newExampleApp(tt)
+	epNames := []string{
+		"PUT /api/{key}", "GET /api", "GET /api/{key}", "POST /api",
+		"DELETE /api/admin/{key}",
+	}
+	api, err := New(app, epNames)
+	assert.NoError(err)
+
+	assert.Len(api.Operations, 5)
+	assert.Equal("PutData", api.Operations[0].Name)
+	paths := make([]string, len(api.Paths))
+	for i, p := range api.Paths {
+		paths[i] = p.Path
+	}
+	assert.Equal([]string{"/api/{key}", "/api", "/api/admin/{key}"}, paths)
+	assert.Equal([]string{"AuthorizeDataSet", "AuthorizeRoot", "AuthorizeAdmin"},
+		api.Middleware)
+
+	path := api.Path("/api/{key}")
+	assert.Equal("AuthorizeDataSet", path.Middleware)
+	assert.Equal([]*Param{{In: InPath, Name: "key", Var: "key", TypeName: "string",
+		GoType: "string"}}, path.PathParams)
+	assert.Len(path.Operations, 2)
+	assert.Equal("GET", path.Operations[0].Method)
+	assert.Equal("PUT", path.Operations[1].Method)
+	assert.Nil(path.Operation("POST"))
+	assert.Nil(api.Path("/unknown"))
+
+	get := path.Operation("GET")
+	assert.Equal("GetData", get.Name)
+	assert.Equal("Data", get.Doc)
+	assert.Equal("/api/{key}", get.Path)
+	assert.Equal([]*Param{{In: InQuery, Name: "time", Var: "queryTime",
+		TypeName: "string", GoType: "string"}}, get.RequestParams())
+	assert.Len(get.PathParams(), 1)
+	assert.Nil(get.Payload)
+	assert.False(get.HasBody())
+	assert.Equal(Response{200, "Data"}, get.Response)
+
+	put := path.Operation("PUT")
+	assert.True(put.HasBody())
+	assert.Equal(&Payload{Name: "dp", Type: "DataPayload"}, put.Payload)
+	assert.Equal("DataPayload", put.Payload.GoType())
+
+	post := api.Path("/api").Operation("POST")
+	assert.Equal(Response{201, "Key"}, post.Response)
+	del := api.Path("/api/admin/{key}").Operation("DELETE")
+	assert.Equal(Response{204, ""}, del.Response)
+
+	assert.Equal(Struct, api.Types.Get("Data").Kind)
+	assert.Equal("data", api.Types.Get("Data").Fields[1].JSON)
+}
+
+func TestNewOperation(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Pet"}}}
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Appname: &pb.AppName{Part: []string{"Pet"}}}}
+	param := &pb.Param{Name: "pet", Type: &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}}}
+	ep := &pb.Endpoint{
+		Name:  "PATCH /pets",
+		Param: []*pb.Param{param},
+		Stmt:  []*pb.Statement{ret},
+		Attrs: map[string]*pb.Attribute{
+			"status":       pbtest.NewStringAttr("202"),
+			"error_status": pbtest.NewStringAttr("404, 409"),
+			"middleware":   pbtest.NewStringAttr("Auth"),
+		},
+	}
+	app := &pb.Application{Endpoints: map[string]*pb.Endpoint{ep.Name: ep}}
+	op, err := NewOperation(app, ep.Name)
+	assert.NoError(err)
+	assert.Equal("PatchPets", op.Name)
+	assert.Equal("PATCH", op.Method)
+	assert.Equal("Auth", op.Middleware)
+	assert.Equal(&Payload{Name: "pet", Type: "Pet", MergePatch: true}, op.Payload)
+	assert.Equal("MergePatch", op.Payload.GoType())
+	assert.Equal(Response{202, "Pet"}, op.Response)
+	assert.Equal([]int{404, 409}, op.ErrorStatuses)
+	assert.Equal(ep, op.Endpoint)
+}
+
+func TestNewOperationErrors(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ret := []*pb.Statement{{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Pet"}}}}
+	var tests = []struct {
+		ep       *pb.Endpoint
+		expected string
+	}{
+		{
+			&pb.Endpoint{Name: "pets"},
+			`expect "GET|POST|etc path/path" as endpoint name (pets) `,
+		},
+		{&pb.Endpoint{Name: "HEAD /pets"}, "invalid HTTP Method (HEAD)"},
+		{
+			&pb.Endpoint{Name: "PATCH /pets", Stmt: ret},
+			"missing merge patch payload in (PATCH /pets)",
+		},
+		{
+			&pb.Endpoint{Name: "GET /pets", Stmt: ret,
+				Attrs: map[string]*pb.Attribute{"status": pbtest.NewStringAttr("404")}},
+			"invalid success status of GET /pets, expect 2xx",
+		},
+		{
+			&pb.Endpoint{Name: "PUT /pets", Stmt: ret,
+				Attrs: map[string]*pb.Attribute{"status": pbtest.NewStringAttr("205")}},
+			"success status 205 of PUT /pets cannot have a result",
+		},
+		{
+			&pb.Endpoint{Name: "GET /pets", Stmt: ret,
+				Attrs: map[string]*pb.Attribute{"error_status": pbtest.NewStringAttr("200")}},
+			"invalid error status '200' of GET /pets, expect 4xx or 5xx",
+		},
+		{
+			&pb.Endpoint{Name: "GET /pets", Stmt: ret,
+				Attrs: map[string]*pb.Attribute{"headers": pbtest.NewStringAttr("X={x <: Kind}")}},
+			"unsupported type Kind of parameter X",
+		},
+		{
+			&pb.Endpoint{Name: "GET /pets", Stmt: ret,
+				RestParams: &pb.Endpoint_RestParams{
+					QueryParam: []*pb.Endpoint_RestParams_QueryParam{
+						newQueryParam("request_id", "{requestID <: string}"),
+					},
+				},
+				Attrs: map[string]*pb.Attribute{"headers": pbtest.NewStringAttr("Request-ID")}},
+			"parameters request_id and Request-ID of GET /pets have the same " +
+				"variable requestID",
+		},
+		{
+			&pb.Endpoint{Name: "POST /pets", Stmt: ret,
+				Param: []*pb.Param{{Name: "pet"}},
+				Attrs: map[string]*pb.Attribute{
+					"headers": pbtest.NewStringAttr("Pet={pet <: string}"),
+				}},
+			"parameter Pet and the payload of POST /pets have the same variable pet",
+		},
+	}
+	for _, t := range tests {
+		app := &pb.Application{Endpoints: map[string]*pb.Endpoint{t.ep.Name: t.ep}}
+		_, err := NewOperation(app, t.ep.Name)
+		assert.EqualError(err, t.expected)
+	}
+
+	app := &pb.Application{}
+	_, err := NewOperation(app, "GET /pets")
+	assert.EqualError(err, "unknown endpoint (GET /pets)")
+	_, err = New(app, []string{"GET /pets"})
+	assert.Error(err)
+
+	ep := &pb.Endpoint{Name: "GET /pets"}
+	app.Endpoints = map[string]*pb.Endpoint{ep.Name: ep}
+	_, err = NewOperation(app, ep.Name)
+	assert.Error(err)
+}
+
+func TestGetMethodName(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := &pb.Endpoint{Name: "GET /api/admin/{key}/creation-times"}
+	assert.Equal("GetApiAdminKeyCreationTimes", GetMethodName(ep))
+	ep.Attrs = map[string]*pb.Attribute{"method_name": pbtest.NewStringAttr("GetTimes")}
+	assert.Equal("GetTimes", GetMethodName(ep))
+}
@@ -0,0 +1,304 @@
+package model
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// Locations of parameters in a request, named as in OpenAPI
+const (
+	InPath   = "path"
+	InQuery  = "query"
+	InHeader = "header"
+	InCookie = "cookie"
+)
+
+// Param is a request parameter of an operation. Query, header and cookie
+// parameters can be lists, optional or have a default value, TypeName and
+// GoType then are those of the elements.
+type Param struct {
+	// In is the location of the parameter, InPath, InQuery, InHeader or InCookie
+	In string
+	// Name is the name of the parameter in the request
+	Name string
+	// Var is the Go variable name of the parameter
+	Var string
+	// TypeName is a Sysl primitive type name or an enum of the application
+	TypeName string
+	// GoType is the Go type of TypeName
+	GoType   string
+	List     bool
+	Optional bool
+	// Default is the value of a missing query, header or cookie parameter
+	Default string
+}
+
+// DeclType returns the Go type of the parameter variable, a slice for lists
+// and a pointer for optional parameters without default
+func (p *Param) DeclType() string {
+	switch {
+	case p.List:
+		return "[]" + p.GoType
+	case p.Optional && p.Default == "":
+		return "*" + p.GoType
+	}
+	return p.GoType
+}
+
+// paramGoTypes maps the Sysl primitive types of parameters to Go types, other
+// type names are enums
+var paramGoTypes = map[string]string{
+	"string":   "string",
+	"int":      "int",
+	"float":    "float64",
+	"decimal":  "float64",
+	"bool":     "bool",
+	"date":     "time.Time",
+	"datetime": "time.Time",
+	"uuid":     "string",
+}
+
+func newParam(in, name, varName, typeName string) *Param {
+	goType, ok := paramGoTypes[typeName]
+	if !ok {
+		goType = typeName
+	}
+	varName = getSafeVarName(varName, handlerVarNames)
+	return &Param{In: in, Name: name, Var: varName, TypeName: typeName, GoType: goType}
+}
+
+// curlyRe matches query parameters "{name <: type}", where type may be a
+// "sequence of type" and is optional with a trailing "?"
+var curlyRe = regexp.MustCompile(
+	`^\s*{\s*(\w+)\s*<:\s*(sequence\s+of\s+)?(\w+)\s*(\?)?\s*}\s*$`)
+
+// newCurlyParam creates a parameter from the curlyRe matches of its definition
+func newCurlyParam(in, name string, matches []string) *Param {
+	p := newParam(in, name, matches[1], matches[3])
+	p.List, p.Optional = matches[2] != "", matches[4] != ""
+	return p
+}
+
+// GetParams returns the path, query, header and cookie parameters of an
+// endpoint in this order, path parameters in the order of the path
+func GetParams(ep *pb.Endpoint) ([]*Param, error) {
+	pathParams, err := getPathParams(ep)
+	if err != nil {
+		return nil, err
+	}
+	headerParams, err := getHeaderParams(ep)
+	if err != nil {
+		return nil, err
+	}
+	params := append(pathParams, getQueryParams(ep)...)
+	return append(params, headerParams...), nil
+}
+
+// GetPatternParams returns the names of the path parameters of an endpoint in
+// the order of the path
+func GetPatternParams(ep *pb.Endpoint) []string {
+	if ep == nil || ep.RestParams == nil {
+		return nil
+	}
+	result := make([]string, 0, len(ep.RestParams.QueryParam))
+	for _, qp := range ep.RestParams.QueryParam {
+		if isPathParam(ep, qp) {
+			result = append([]string{qp.Name}, result...)
+		}
+	}
+	return result
+}
+
+// isPathParam reports whether a Sysl endpoint parameter is part of the URL path
+// rather than the query. Query parameters are type references in curly syntax.
+func isPathParam(ep *pb.Endpoint, qp *pb.Endpoint_RestParams_QueryParam) bool {
+	if qp.Type.GetTypeRef() == nil {
+		return true
+	}
+	path := qp.Type.GetTypeRef().GetRef().GetPath()
+	if len(path) == 1 && curlyRe.MatchString(path[0]) {
+		return false
+	}
+	return strings.Contains(ep.Name, "{"+qp.Name+"}")
+}
+
+// getPathParams returns the path parameters of an endpoint in the order of
+// GetPatternParams
+func getPathParams(ep *pb.Endpoint) ([]*Param, error) {
+	if ep == nil || ep.RestParams == nil {
+		return nil, nil
+	}
+	result := make([]*Param, 0, len(ep.RestParams.QueryParam))
+	for _, qp := range ep.RestParams.QueryParam {
+		if !isPathParam(ep, qp) {
+			continue
+		}
+		typeName := strings.ToLower(qp.Type.GetPrimitive().String())
+		if path := qp.Type.GetTypeRef().GetRef().GetPath(); len(path) == 1 {
+			typeName = path[0]
+		} else if qp.Type.GetPrimitive() == pb.Type_NO_Primitive {
+			return nil, fmt.Errorf("unknown type of path parameter %s", qp.Name)
+		}
+		p := newParam(InPath, qp.Name, qp.Name, typeName)
+		result = append([]*Param{p}, result...)
+	}
+	return result, nil
+}
+
+func getQueryParams(ep *pb.Endpoint) []*Param {
+	if ep == nil || ep.RestParams == nil {
+		return nil
+	}
+	result := make([]*Param, 0, len(ep.RestParams.QueryParam))
+	for _, qp := range ep.RestParams.QueryParam {
+		if isPathParam(ep, qp) {
+			continue
+		}
+		p := newParam(InQuery, qp.Name, qp.Name, "string")
+		path := qp.Type.GetTypeRef().GetRef().GetPath()
+		if len(path) == 1 {
+			if matches := curlyRe.FindStringSubmatch(path[0]); matches != nil {
+				p = newCurlyParam(InQuery, qp.Name, matches)
+			}
+		}
+		p.Optional = p.Optional || qp.Type.Opt
+		if attr, ok := ep.Attrs["default_"+qp.Name]; ok {
+			p.Default = attr.GetS()
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// getHeaderParams returns the header and cookie parameters of an endpoint
+// defined in its headers and cookies attributes. The attributes hold a comma
+// separated list or an array of definitions "Name" or "Name={var <: type}",
+// e.g. "X-Request-ID, If-Match={ifMatch <: string?}". Without a type the
+// parameter is a required string named after Name in camel case.
+func getHeaderParams(ep *pb.Endpoint) ([]*Param, error) {
+	var result []*Param
+	for _, in := range []string{InHeader, InCookie} {
+		for _, def := range getAttrList(ep.GetAttrs()[in+"s"]) {
+			fields := strings.SplitN(def, "=", 2)
+			name := strings.TrimSpace(fields[0])
+			p := newParam(in, name, getParamVarName(name), "string")
+			if len(fields) == 2 {
+				matches := curlyRe.FindStringSubmatch(fields[1])
+				if matches == nil {
+					return nil, fmt.Errorf("invalid %s parameter '%s'", in, def)
+				}
+				p = newCurlyParam(in, name, matches)
+			}
+			if name == "" || in == InCookie && p.List {
+				return nil, fmt.Errorf("invalid %s parameter '%s'", in, def)
+			}
+			if attr, ok := ep.Attrs["default_"+name]; ok {
+				p.Default = attr.GetS()
+			}
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// getAttrList returns the elements of an array attribute or the comma
+// separated elements of a string attribute
+func getAttrList(attr *pb.Attribute) []string {
+	var result []string
+	if attr.GetA() != nil {
+		for _, elt := range attr.GetA().GetElt() {
+			result = append(result, elt.GetS())
+		}
+		return result
+	}
+	for _, s := range strings.Split(attr.GetS(), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+var reParamNameSeparate = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// getParamVarName creates a camel case Go variable name from a header or
+// cookie name, e.g. xRequestID from X-Request-ID
+func getParamVarName(name string) string {
+	var varName string
+	for _, field := range reParamNameSeparate.Split(name, -1) {
+		switch {
+		case field == "":
+		case varName == "":
+			varName = strings.ToLower(field[:1]) + field[1:]
+		default:
+			varName += strings.Title(field)
+		}
+	}
+	return varName
+}
+
+// reservedVarNames holds the local variables and imported packages of the
+// generated client, MemStorer and mocks that parameters and payloads must not
+// shadow
+var reservedVarNames = map[string]bool{
+	"err": true, "result": true, "c": true, "q": true, "h": true, "v": true,
+	"ctx": true, "ms": true, "mock": true, "context": true, "errors": true,
+	"fmt": true, "http": true, "json": true, "strconv": true, "strings": true,
+	"time": true, "url": true,
+}
+
+// handlerVarNames holds the local variables and imported packages of the
+// generated REST handlers, which parameters must not shadow in addition to
+// reservedVarNames
+var handlerVarNames = map[string]bool{
+	"w": true, "r": true, "payload": true, "data": true, "rh": true, "s": true,
+	"values": true, "chi": true, "render": true, "io": true, "ioutil": true,
+	"reflect": true,
+}
+
+// getSafeVarName returns name with the suffix Param if it is a Go keyword or
+// a reserved variable name, e.g. typeParam for type
+func getSafeVarName(name string, names ...map[string]bool) string {
+	if token.IsKeyword(name) || reservedVarNames[name] {
+		return name + "Param"
+	}
+	for _, reserved := range names {
+		if reserved[name] {
+			return name + "Param"
+		}
+	}
+	return name
+}
+
+// checkParam returns an error if the type of a parameter is neither a
+// supported Sysl primitive nor an enum of the application or if its default
+// value is invalid
+func checkParam(app *pb.Application, p *Param) error {
+	if _, ok := paramGoTypes[p.TypeName]; !ok && !isEnum(app.Types, p.TypeName) {
+		return fmt.Errorf("unsupported type %s of parameter %s", p.TypeName, p.Name)
+	}
+	if p.Default == "" {
+		return nil
+	}
+	if p.List {
+		return fmt.Errorf("list parameter %s cannot have a default", p.Name)
+	}
+	var err error
+	switch p.TypeName {
+	case "int":
+		_, err = strconv.Atoi(p.Default)
+	case "float", "decimal":
+		_, err = strconv.ParseFloat(p.Default, 64)
+	case "bool":
+		_, err = strconv.ParseBool(p.Default)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid default '%s' of parameter %s", p.Default, p.Name)
+	}
+	return nil
+}
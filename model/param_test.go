@@ -0,0 +1,129 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func newQueryParam(name, ref string) *pb.Endpoint_RestParams_QueryParam {
+	scoped := &pb.ScopedRef{Ref: &pb.Scope{Path: []string{ref}}}
+	t := &pb.Type{Type: &pb.Type_TypeRef{TypeRef: scoped}}
+	return &pb.Endpoint_RestParams_QueryParam{Name: name, Type: t}
+}
+
+func TestGetParams(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	id := &pb.Type{Type: &pb.Type_Primitive_{Primitive: pb.Type_INT}}
+	ep := &pb.Endpoint{
+		Name: "GET /pets/{id}/{kind}",
+		RestParams: &pb.Endpoint_RestParams{QueryParam: []*pb.Endpoint_RestParams_QueryParam{
+			newQueryParam("limit", "{limit <: int?}"),
+			newQueryParam("tag", "{tags <: sequence of string}"),
+			newQueryParam("kind", "Kind"),
+			{Name: "id", Type: id},
+		}},
+		Attrs: map[string]*pb.Attribute{
+			"headers":       pbtest.NewStringAttr("X-Request-ID, If-Match={ifMatch <: string?}"),
+			"cookies":       pbtest.NewStringAttr("session"),
+			"default_limit": pbtest.NewStringAttr("10"),
+		},
+	}
+	params, err := GetParams(ep)
+	assert.NoError(err)
+	assert.Equal([]*Param{
+		{In: InPath, Name: "id", Var: "id", TypeName: "int", GoType: "int"},
+		{In: InPath, Name: "kind", Var: "kind", TypeName: "Kind", GoType: "Kind"},
+		{In: InQuery, Name: "limit", Var: "limit", TypeName: "int", GoType: "int",
+			Optional: true, Default: "10"},
+		{In: InQuery, Name: "tag", Var: "tags", TypeName: "string", GoType: "string",
+			List: true},
+		{In: InHeader, Name: "X-Request-ID", Var: "xRequestID", TypeName: "string",
+			GoType: "string"},
+		{In: InHeader, Name: "If-Match", Var: "ifMatch", TypeName: "string",
+			GoType: "string", Optional: true},
+		{In: InCookie, Name: "session", Var: "session", TypeName: "string",
+			GoType: "string"},
+	}, params)
+	assert.Equal([]string{"id", "kind"}, GetPatternParams(ep))
+
+	assert.Equal("int", params[2].DeclType())
+	assert.Equal("[]string", params[3].DeclType())
+	assert.Equal("*string", params[5].DeclType())
+
+	params, err = GetParams(nil)
+	assert.NoError(err)
+	assert.Empty(params)
+	assert.Empty(GetPatternParams(nil))
+}
+
+func TestGetParamsReservedNames(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := &pb.Endpoint{
+		Name: "GET /pets/{type}",
+		RestParams: &pb.Endpoint_RestParams{QueryParam: []*pb.Endpoint_RestParams_QueryParam{
+			{Name: "type", Type: &pb.Type{Type: &pb.Type_Primitive_{Primitive: pb.Type_STRING}}},
+			newQueryParam("range", "{range <: int}"),
+			newQueryParam("r", "string"),
+			newQueryParam("data", "{data <: string}"),
+		}},
+		Attrs: map[string]*pb.Attribute{
+			"headers": pbtest.NewStringAttr("Err, Payload, X-Limit, Render"),
+			"cookies": pbtest.NewStringAttr("url={w <: string}"),
+		},
+		Param: []*pb.Param{{Name: "c"}},
+	}
+	params, err := GetParams(ep)
+	assert.NoError(err)
+	vars := make([]string, len(params))
+	for i, p := range params {
+		vars[i] = p.Var
+	}
+	assert.Equal([]string{"typeParam", "rangeParam", "rParam", "dataParam", "errParam",
+		"payloadParam", "xLimit", "renderParam", "wParam"}, vars)
+	assert.Equal("cParam", GetPayload(ep).Name)
+	ep.Param[0].Name = "r"
+	assert.Equal("r", GetPayload(ep).Name)
+}
+
+func TestGetParamsErrors(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := &pb.Endpoint{
+		Name: "GET /pets/{id}",
+		RestParams: &pb.Endpoint_RestParams{QueryParam: []*pb.Endpoint_RestParams_QueryParam{
+			{Name: "id", Type: &pb.Type{}},
+		}},
+	}
+	_, err := GetParams(ep)
+	assert.EqualError(err, "unknown type of path parameter id")
+
+	for _, attr := range []string{"headers", "cookies"} {
+		ep = &pb.Endpoint{Attrs: map[string]*pb.Attribute{attr: pbtest.NewStringAttr("X=x")}}
+		_, err = GetParams(ep)
+		assert.Error(err)
+	}
+	ep.Attrs["cookies"] = pbtest.NewStringAttr("c={c <: sequence of string}")
+	_, err = GetParams(ep)
+	assert.EqualError(err, "invalid cookie parameter 'c={c <: sequence of string}'")
+}
+
+func TestCheckParam(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	enum := &pb.Type{Type: &pb.Type_Enum_{Enum: &pb.Type_Enum{}}}
+	app := &pb.Application{Types: map[string]*pb.Type{"Kind": enum}}
+	assert.NoError(checkParam(app, newParam(InQuery, "k", "k", "Kind")))
+	assert.EqualError(checkParam(app, newParam(InQuery, "x", "x", "xml")),
+		"unsupported type xml of parameter x")
+
+	p := newParam(InQuery, "n", "n", "int")
+	p.Default = "ten"
+	assert.EqualError(checkParam(app, p), "invalid default 'ten' of parameter n")
+	p.Default, p.List = "10", true
+	assert.EqualError(checkParam(app, p), "list parameter n cannot have a default")
+}
@@ -0,0 +1,358 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// Kinds of named types
+const (
+	// Struct is a Sysl tuple type
+	Struct = "struct"
+	// Enum is a Sysl enum type
+	Enum = "enum"
+	// Union is a Sysl one-of type of tuple types
+	Union = "union"
+)
+
+// Type is a named type of an application
+type Type struct {
+	Name string
+	// Kind is Struct, Enum or Union
+	Kind string
+	Doc  string
+	// Fields holds the fields of a struct in source order
+	Fields []*Field
+	// Items holds the items of an enum ordered by value
+	Items []*EnumItem
+	// Variants holds the type names of the variants of a union and
+	// Discriminator the JSON property naming the variant
+	Variants      []string
+	Discriminator string
+	Sysl          *pb.Type
+}
+
+// Field is a field of a struct type
+type Field struct {
+	Name string
+	// JSON is the JSON property name
+	JSON string
+	// GoType is the Go type of the field value
+	GoType   string
+	Optional bool
+	Doc      string
+	// Sysl is the Sysl type of the field with its constraints
+	Sysl *pb.Type
+}
+
+// EnumItem is an item of an enum type
+type EnumItem struct {
+	Name  string
+	Value int64
+}
+
+// Types holds the named types of an application in source order
+type Types []*Type
+
+// Get returns the type with given name, nil if there is none
+func (ts Types) Get(name string) *Type {
+	for _, t := range ts {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// Is reports whether the type with given name is of kind
+func (ts Types) Is(name, kind string) bool {
+	t := ts.Get(name)
+	return t != nil && t.Kind == kind
+}
+
+// NewTypes creates the model of the types of an application in source order.
+// Types that are neither enums nor one-of types have to be tuples.
+func NewTypes(app *pb.Application) (Types, error) {
+	types := app.GetTypes()
+	names, err := NamesSortedBySourceContext(types)
+	if err != nil {
+		return nil, err
+	}
+	jsonSep := app.Attrs["json_property_separator"].GetS()
+	result := make(Types, 0, len(names))
+	for _, name := range names {
+		t := types[name]
+		typ := &Type{Name: name, Doc: t.Attrs["doc"].GetS(), Sysl: t}
+		switch {
+		case t.GetEnum() != nil:
+			typ.Kind = Enum
+			typ.Items = GetEnumItems(t)
+		case t.GetOneOf() != nil:
+			typ.Kind = Union
+			typ.Discriminator = GetDiscriminator(app, t)
+			if typ.Variants, err = GetUnionVariants(name, t, types); err != nil {
+				return nil, err
+			}
+		case t.GetTuple() != nil:
+			typ.Kind = Struct
+			if typ.Fields, err = GetFields(t, jsonSep); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("top level type has to be Tuple")
+		}
+		result = append(result, typ)
+	}
+	return result, nil
+}
+
+// GetFields returns the fields of a tuple type in source order, the JSON
+// property names are separated with sep
+func GetFields(t *pb.Type, sep string) ([]*Field, error) {
+	attrDefs := t.GetTuple().GetAttrDefs()
+	names, err := NamesSortedBySourceContext(attrDefs)
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]*Field, 0, len(names))
+	for _, name := range names {
+		field, err := NewField(name, attrDefs[name], sep)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// NewField creates a field of Sysl type t, the JSON property name is
+// separated with sep
+func NewField(name string, t *pb.Type, sep string) (*Field, error) {
+	goType, subType, err := GetType(t)
+	if err != nil {
+		return nil, err
+	}
+	return &Field{
+		Name:     name,
+		JSON:     GetJSONProperty(name, subType, sep),
+		GoType:   goType,
+		Optional: t.Opt,
+		Doc:      t.Attrs["doc"].GetS(),
+		Sysl:     t,
+	}, nil
+}
+
+// GetEnumItems returns the items of an enum type ordered by value
+func GetEnumItems(t *pb.Type) []*EnumItem {
+	items := t.GetEnum().GetItems()
+	result := make([]*EnumItem, 0, len(items))
+	for name, value := range items {
+		result = append(result, &EnumItem{name, value})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		return a.Value < b.Value || a.Value == b.Value && a.Name < b.Name
+	})
+	return result
+}
+
+func isEnum(types map[string]*pb.Type, name string) bool {
+	t, ok := types[name]
+	return ok && t.GetEnum() != nil
+}
+
+func isTuple(types map[string]*pb.Type, name string) bool {
+	t, ok := types[name]
+	return ok && t.GetTuple() != nil
+}
+
+// GetDiscriminator returns the JSON property naming the variant of a one-of
+// type from the type's or application's discriminator attribute, "type" by
+// default
+func GetDiscriminator(app *pb.Application, t *pb.Type) string {
+	if attr, ok := t.Attrs["discriminator"]; ok {
+		return attr.GetS()
+	}
+	if attr, ok := app.Attrs["discriminator"]; ok {
+		return attr.GetS()
+	}
+	return "type"
+}
+
+// GetUnionVariants returns the type names of the variants of a Sysl OneOf type,
+// which have to reference tuple types
+func GetUnionVariants(name string, t *pb.Type,
+	types map[string]*pb.Type) ([]string, error) {
+	variants := make([]string, 0, len(t.GetOneOf().GetType()))
+	for _, v := range t.GetOneOf().GetType() {
+		path := v.GetTypeRef().GetRef().GetPath()
+		if len(path) != 1 || !isTuple(types, path[0]) {
+			return nil, fmt.Errorf("variant of one-of %s has to reference a tuple type", name)
+		}
+		variants = append(variants, path[0])
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("one-of %s has no variants", name)
+	}
+	return variants, nil
+}
+
+// GetPrimitiveType return Golang type string for Sysl primitive data type
+func GetPrimitiveType(tp *pb.Type_Primitive) (string, error) {
+	switch *tp {
+	case pb.Type_BOOL:
+		return "bool", nil
+	case pb.Type_ANY:
+		return "interface{}", nil
+	case pb.Type_INT:
+		return "int", nil
+	case pb.Type_STRING:
+		return "string", nil
+	case pb.Type_EMPTY:
+		return "nil", nil
+	case pb.Type_FLOAT, pb.Type_DECIMAL:
+		return "float64", nil
+	case pb.Type_BYTES:
+		return "[]byte", nil
+	case pb.Type_DATE, pb.Type_DATETIME:
+		return "time.Time", nil
+	}
+	// Type_XML, Type_UUID
+	return "", fmt.Errorf("unsupported type primitive %s", tp.String())
+}
+
+// GetSimpleType returns Golang type string for non-composite types (no lists and sets)
+func GetSimpleType(t *pb.Type) (string, error) {
+	if pType := t.GetPrimitive(); pType != pb.Type_NO_Primitive {
+		return GetPrimitiveType(&pType)
+	}
+	if t.GetTypeRef() != nil {
+		path := t.GetTypeRef().GetRef().GetPath()
+		if len(path) != 1 {
+			return "", fmt.Errorf("cannot handle type reference with more than one path")
+		}
+		str := path[0]
+		if !strings.HasPrefix(str, "map of") {
+			return str, nil
+		}
+		str = strings.TrimPrefix(str, "map of")
+		str = strings.Trim(str, " ")
+		m := strings.Split(str, ":")
+		if len(m) != 2 {
+			shouldStr := `should be map of KeyType:ValueType`
+			return "", fmt.Errorf("bad map definition '%s' (%s)", str, shouldStr)
+		}
+		return fmt.Sprintf("map[%s]%s", m[0], m[1]), nil
+	}
+	return "", fmt.Errorf("type %v is neither primitive nor reference", t)
+
+}
+
+// GetType creates golang type for given sysl type
+func GetType(t *pb.Type) (string, *pb.Type, error) {
+	var err error
+	var typeStr string
+	if t.GetPrimitive() != pb.Type_NO_Primitive || t.GetTypeRef() != nil {
+		// Primitive type, reference or map
+		if typeStr, err = GetSimpleType(t); err == nil {
+			return typeStr, t, nil
+		}
+	} else if t.GetList() != nil {
+		// List
+		t = t.GetList().GetType()
+		if typeStr, err = GetSimpleType(t); err == nil {
+			return fmt.Sprintf("[]%s", typeStr), t, nil
+		}
+	} else if t.GetSet() != nil {
+		// Set
+		t = t.GetSet()
+		if typeStr, err = GetSimpleType(t); err == nil {
+			return fmt.Sprintf("map[%s]interface{}", typeStr), t, nil
+		}
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return "", nil, fmt.Errorf("unknown type %s", t.String())
+}
+
+// GetTypeLine returns the line for a given Sysl type from its SourceContext
+func GetTypeLine(t *pb.Type) (int32, error) {
+	if t.GetPrimitive() != pb.Type_NO_Primitive || t.GetTypeRef() != nil {
+		return t.SourceContext.Start.Line, nil
+	}
+	if t.GetList() != nil {
+		return t.GetList().GetType().SourceContext.Start.Line, nil
+	}
+	if t.GetSet() != nil {
+		return t.GetSet().SourceContext.Start.Line, nil
+	}
+	if t.GetTuple() != nil {
+		for _, t2 := range t.GetTuple().GetAttrDefs() {
+			return GetTypeLine(t2)
+		}
+	}
+	if t.GetEnum() != nil && t.SourceContext != nil {
+		return t.SourceContext.Start.Line, nil
+	}
+	if t.GetOneOf() != nil {
+		if t.SourceContext != nil {
+			return t.SourceContext.Start.Line, nil
+		}
+		for _, t2 := range t.GetOneOf().GetType() {
+			return GetTypeLine(t2)
+		}
+	}
+	return 0, fmt.Errorf("unknown type %v for getting line", t)
+}
+
+// NamesSortedBySourceContext sorts the keys of the input types according to
+// occurrence in Sysl definition file, derived from SourceContext
+func NamesSortedBySourceContext(types map[string]*pb.Type) ([]string, error) {
+	names := make([]string, 0, len(types))
+	lines := make(map[string]int32, len(types))
+	for name, t := range types {
+		line, err := GetTypeLine(t)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		lines[name] = line
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return lines[names[i]] < lines[names[j]]
+	})
+	return names, nil
+}
+
+// SplitUppercase splits into fields at all upper case letters and converts
+// fields to lower case
+func SplitUppercase(str string) []string {
+	result := make([]string, 0, 8)
+	idx := make([]int, 0, 8)
+	for pos, c := range str {
+		if unicode.IsUpper(c) || pos == 0 {
+			idx = append(idx, pos)
+		}
+	}
+	idx = append(idx, len(str))
+	for i := 0; i < len(idx)-1; i++ {
+		result = append(result, strings.ToLower(str[idx[i]:idx[i+1]]))
+	}
+	return result
+}
+
+// GetJSONProperty extracts JSON property name from attribute and defaults to type name
+func GetJSONProperty(name string, t *pb.Type, sep string) string {
+	if attrOverride, ok := t.Attrs["json"]; ok {
+		return attrOverride.GetS()
+	}
+	if sep == "" {
+		return name
+	}
+	return strings.Join(SplitUppercase(name), sep)
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func newTypesApp() *pb.Application {
+	nick := pbtest.NewPrimitiveType(3, pb.Type_STRING)
+	nick.Opt = true
+	nick.Attrs = map[string]*pb.Attribute{"doc": pbtest.NewStringAttr("Nick name")}
+	oneOf := &pb.Type_OneOf{Type: []*pb.Type{pbtest.NewRefType(5, "Cat")}}
+	enum := &pb.Type_Enum{Items: map[string]int64{"B": 1, "A": 1, "C": 0}}
+	return &pb.Application{
+		Types: map[string]*pb.Type{
+			"Cat": pbtest.NewLineType(2, pbtest.NewTupleType(map[string]*pb.Type{
+				"FirstName": pbtest.NewPrimitiveType(2, pb.Type_STRING),
+				"Nick":      nick,
+				"Born":      pbtest.NewPrimitiveType(4, pb.Type_DATE),
+			})),
+			"Pet":  pbtest.NewLineType(5, &pb.Type{Type: &pb.Type_OneOf_{OneOf: oneOf}}),
+			"Kind": pbtest.NewLineType(1, &pb.Type{Type: &pb.Type_Enum_{Enum: enum}}),
+		},
+		Attrs: map[string]*pb.Attribute{
+			"json_property_separator": pbtest.NewStringAttr("_"),
+			"discriminator":           pbtest.NewStringAttr("kind"),
+		},
+	}
+}
+
+func TestNewTypes(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := newTypesApp()
+	types, err := NewTypes(app)
+	assert.NoError(err)
+	assert.Len(types, 3)
+
+	kind := types[0]
+	assert.Equal("Kind", kind.Name)
+	assert.Equal(Enum, kind.Kind)
+	assert.Equal([]*EnumItem{{"C", 0}, {"A", 1}, {"B", 1}}, kind.Items)
+
+	cat := types.Get("Cat")
+	assert.Equal(cat, types[1])
+	assert.Equal(Struct, cat.Kind)
+	assert.Equal(&Field{
+		Name: "FirstName", JSON: "first_name", GoType: "string",
+		Sysl: app.Types["Cat"].GetTuple().AttrDefs["FirstName"],
+	}, cat.Fields[0])
+	assert.Equal("Nick", cat.Fields[1].Name)
+	assert.True(cat.Fields[1].Optional)
+	assert.Equal("Nick name", cat.Fields[1].Doc)
+	assert.Equal("time.Time", cat.Fields[2].GoType)
+
+	pet := types.Get("Pet")
+	assert.Equal(Union, pet.Kind)
+	assert.Equal([]string{"Cat"}, pet.Variants)
+	assert.Equal("kind", pet.Discriminator)
+
+	assert.True(types.Is("Cat", Struct))
+	assert.False(types.Is("Cat", Enum))
+	assert.False(types.Is("Dog", Struct))
+	assert.Nil(types.Get("Dog"))
+}
+
+func TestNewTypesErrors(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := newTypesApp()
+	app.Types["Pet"].GetOneOf().Type = []*pb.Type{pbtest.NewRefType(5, "Kind")}
+	_, err := NewTypes(app)
+	assert.EqualError(err, "variant of one-of Pet has to reference a tuple type")
+
+	app = newTypesApp()
+	app.Types["Bad"] = pbtest.NewPrimitiveType(6, pb.Type_STRING)
+	_, err = NewTypes(app)
+	assert.EqualError(err, "top level type has to be Tuple")
+
+	app = newTypesApp()
+	app.Types["Cat"].GetTuple().AttrDefs["X"] = pbtest.NewPrimitiveType(7, pb.Type_XML)
+	_, err = NewTypes(app)
+	assert.EqualError(err, "unsupported type primitive XML")
+
+	app = newTypesApp()
+	app.Types["Bad"] = &pb.Type{}
+	_, err = NewTypes(app)
+	assert.Error(err)
+}
+
+func TestGetType(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	list := &pb.Type{Type: &pb.Type_List_{List: &pb.Type_List{
+		Type: pbtest.NewRefType(1, "Cat"),
+	}}}
+	set := &pb.Type{Type: &pb.Type_Set{Set: pbtest.NewPrimitiveType(1, pb.Type_INT)}}
+	var tests = []struct {
+		input    *pb.Type
+		expected string
+	}{
+		{pbtest.NewPrimitiveType(1, pb.Type_DECIMAL), "float64"},
+		{pbtest.NewRefType(1, "map of string:int"), "map[string]int"},
+		{list, "[]Cat"},
+		{set, "map[int]interface{}"},
+	}
+	for _, t := range tests {
+		typeStr, _, err := GetType(t.input)
+		assert.NoError(err)
+		assert.Equal(t.expected, typeStr)
+	}
+
+	_, _, err := GetType(pbtest.NewRefType(1, "map of string"))
+	assert.Error(err)
+	_, _, err = GetType(&pb.Type{})
+	assert.Error(err)
+}
+
+func TestGetJSONProperty(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	t := pbtest.NewPrimitiveType(1, pb.Type_STRING)
+	assert.Equal("CreationTime", GetJSONProperty("CreationTime", t, ""))
+	assert.Equal("creation-time", GetJSONProperty("CreationTime", t, "-"))
+	t.Attrs = map[string]*pb.Attribute{"json": pbtest.NewStringAttr("created")}
+	assert.Equal("created", GetJSONProperty("CreationTime", t, "-"))
+}
@@ -0,0 +1,387 @@
+package gosysl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+type openAPI struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas,omitempty"`
+}
+
+type openAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Description string                      `json:"description,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	MinLength            *int64                    `json:"minLength,omitempty"`
+	MaxLength            *int64                    `json:"maxLength,omitempty"`
+	Minimum              *json.Number              `json:"minimum,omitempty"`
+	Maximum              *json.Number              `json:"maximum,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	OneOf                []*openAPISchema          `json:"oneOf,omitempty"`
+	Discriminator        *openAPIDiscriminator     `json:"discriminator,omitempty"`
+	Default              interface{}               `json:"default,omitempty"`
+}
+
+type openAPIDiscriminator struct {
+	PropertyName string            `json:"propertyName"`
+	Mapping      map[string]string `json:"mapping,omitempty"`
+}
+
+// openAPIPrimitives maps Sysl primitive type names to OpenAPI schemas
+var openAPIPrimitives = map[string]openAPISchema{
+	"any":      {},
+	"bool":     {Type: "boolean"},
+	"int":      {Type: "integer"},
+	"float":    {Type: "number"},
+	"decimal":  {Type: "number"},
+	"string":   {Type: "string"},
+	"bytes":    {Type: "string", Format: "byte"},
+	"date":     {Type: "string", Format: "date"},
+	"datetime": {Type: "string", Format: "date-time"},
+	"uuid":     {Type: "string", Format: "uuid"},
+}
+
+// WriteOpenAPI creates an OpenAPI 3 document in JSON for the REST endpoints
+// and types of a Sysl application
+func WriteOpenAPI(w io.Writer, app *pb.Application, epNames []string) error {
+	rs, err := getRoutes(app, epNames)
+	if err != nil {
+		return err
+	}
+	doc := openAPI{
+		OpenAPI: "3.0.0",
+		Info:    getOpenAPIInfo(app),
+		Paths:   make(map[string]map[string]*openAPIOperation, len(rs.Paths)),
+	}
+	for _, path := range rs.Paths {
+		operations := make(map[string]*openAPIOperation, len(path.Operations))
+		for _, op := range path.Operations {
+			operation := getOpenAPIOperation(op)
+			operations[strings.ToLower(op.Method)] = operation
+			if op.Method == "GET" {
+				operations["head"] = getOpenAPIHeadOperation(operation)
+			}
+		}
+		doc.Paths[path.Path] = operations
+	}
+	doc.Components.Schemas = getOpenAPISchemas(rs.Types)
+	doc.Components.Schemas["Problem"] = getOpenAPIProblemSchema()
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+func getOpenAPIInfo(app *pb.Application) openAPIInfo {
+	info := openAPIInfo{
+		Title:       app.LongName,
+		Description: app.Docstring,
+		Version:     "1.0.0",
+	}
+	if info.Title == "" {
+		info.Title = strings.Join(app.GetName().GetPart(), " :: ")
+	}
+	if attr, ok := app.Attrs["version"]; ok {
+		info.Version = attr.GetS()
+	}
+	if attr, ok := app.Attrs["interface_doc"]; ok && info.Description == "" {
+		info.Description = attr.GetS()
+	}
+	return info
+}
+
+func getOpenAPIOperation(o *model.Operation) *openAPIOperation {
+	op := &openAPIOperation{
+		OperationID: o.Name,
+		Description: o.Doc,
+		Responses:   make(map[string]*openAPIResponse, 2),
+	}
+	for _, p := range o.Params {
+		param := &openAPIParameter{Name: p.Name, In: p.In,
+			Required: !p.Optional && p.Default == ""}
+		param.Schema = getOpenAPITypeNameSchema(p.TypeName)
+		if p.Default != "" {
+			param.Schema.Default = getOpenAPIDefault(p)
+		}
+		if p.List {
+			param.Schema = &openAPISchema{Type: "array", Items: param.Schema}
+		}
+		op.Parameters = append(op.Parameters, param)
+	}
+	if o.HasBody() && o.Payload != nil && o.Payload.Type != "" {
+		content := getOpenAPIJSONContent(getOpenAPITypeNameSchema(o.Payload.Type))
+		if o.Payload.MergePatch {
+			content["application/merge-patch+json"] = content["application/json"]
+			delete(content, "application/json")
+		}
+		op.RequestBody = &openAPIRequestBody{Required: true, Content: content}
+	}
+	var content map[string]*openAPIMediaType
+	if o.Response.Type != "" {
+		content = getOpenAPIJSONContent(getOpenAPITypeNameSchema(o.Response.Type))
+	}
+	status := o.Response.Status
+	op.Responses[strconv.Itoa(status)] = &openAPIResponse{
+		Description: http.StatusText(status),
+		Content:     content,
+	}
+	errContent := map[string]*openAPIMediaType{
+		"application/problem+json": {Schema: getOpenAPITypeNameSchema("Problem")},
+	}
+	for _, status := range o.ErrorStatuses {
+		op.Responses[strconv.Itoa(status)] = &openAPIResponse{
+			Description: http.StatusText(status),
+			Content:     errContent,
+		}
+	}
+	op.Responses["default"] = &openAPIResponse{Description: "Error", Content: errContent}
+	return op
+}
+
+// getOpenAPIProblemSchema returns the schema of the problem details (RFC 7807)
+// written by the generated error encoder EncodeProblem, error responses
+// reference it as component Problem
+func getOpenAPIProblemSchema() *openAPISchema {
+	return &openAPISchema{
+		Type: "object",
+		Properties: map[string]*openAPISchema{
+			"type":    {Type: "string"},
+			"title":   {Type: "string"},
+			"status":  {Type: "integer"},
+			"detail":  {Type: "string"},
+			"code":    {Type: "string"},
+			"details": {},
+		},
+		Required: []string{"status", "title", "type"},
+	}
+}
+
+// getOpenAPIDefault returns the default value of a query parameter as JSON
+// number, boolean or string
+func getOpenAPIDefault(p *model.Param) interface{} {
+	switch p.TypeName {
+	case "int", "float", "decimal":
+		return json.Number(p.Default)
+	case "bool":
+		return p.Default == "true"
+	}
+	return p.Default
+}
+
+// getOpenAPIHeadOperation creates the HEAD operation served by a GET handler,
+// its success response has no content
+func getOpenAPIHeadOperation(get *openAPIOperation) *openAPIOperation {
+	head := &openAPIOperation{
+		OperationID: "Head" + strings.TrimPrefix(get.OperationID, "Get"),
+		Description: get.Description,
+		Parameters:  get.Parameters,
+		Responses:   make(map[string]*openAPIResponse, len(get.Responses)),
+	}
+	for code, resp := range get.Responses {
+		if strings.HasPrefix(code, "2") {
+			resp = &openAPIResponse{Description: resp.Description}
+		}
+		head.Responses[code] = resp
+	}
+	return head
+}
+
+func getOpenAPIJSONContent(schema *openAPISchema) map[string]*openAPIMediaType {
+	return map[string]*openAPIMediaType{"application/json": {Schema: schema}}
+}
+
+func getOpenAPISchemas(types model.Types) map[string]*openAPISchema {
+	schemas := make(map[string]*openAPISchema, len(types))
+	for _, t := range types {
+		switch t.Kind {
+		case model.Enum:
+			schemas[t.Name] = getOpenAPIEnumSchema(t)
+		case model.Union:
+			schemas[t.Name] = getOpenAPIUnionSchema(t)
+		default:
+			schemas[t.Name] = getOpenAPIStructSchema(t)
+		}
+	}
+	for _, t := range types {
+		if t.Kind == model.Union {
+			addOpenAPIDiscriminator(schemas, t)
+		}
+	}
+	return schemas
+}
+
+func getOpenAPIStructSchema(t *model.Type) *openAPISchema {
+	schema := &openAPISchema{
+		Type:        "object",
+		Description: t.Doc,
+		Properties:  make(map[string]*openAPISchema, len(t.Fields)),
+	}
+	for _, f := range t.Fields {
+		property := getOpenAPISchema(f.Sysl)
+		property.Description = f.Doc
+		addOpenAPIConstraints(property, f.Sysl)
+		schema.Properties[f.JSON] = property
+		if !f.Optional {
+			schema.Required = append(schema.Required, f.JSON)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+func getOpenAPIEnumSchema(t *model.Type) *openAPISchema {
+	schema := &openAPISchema{Type: "string", Description: t.Doc}
+	for _, item := range t.Items {
+		schema.Enum = append(schema.Enum, item.Name)
+	}
+	sort.Strings(schema.Enum)
+	return schema
+}
+
+// getOpenAPIUnionSchema creates a oneOf schema for a one-of type, the variants
+// are told apart by the discriminator property holding the type name
+func getOpenAPIUnionSchema(t *model.Type) *openAPISchema {
+	schema := &openAPISchema{
+		Description: t.Doc,
+		Discriminator: &openAPIDiscriminator{
+			PropertyName: t.Discriminator,
+			Mapping:      make(map[string]string, len(t.Variants)),
+		},
+	}
+	for _, v := range t.Variants {
+		ref := getOpenAPITypeNameSchema(v)
+		schema.OneOf = append(schema.OneOf, ref)
+		schema.Discriminator.Mapping[v] = ref.Ref
+	}
+	return schema
+}
+
+// addOpenAPIDiscriminator adds the discriminator property written by the
+// union's MarshalJSON to the schemas of its variants, its value is the
+// variant's type name
+func addOpenAPIDiscriminator(schemas map[string]*openAPISchema, t *model.Type) {
+	for _, v := range t.Variants {
+		schema, ok := schemas[v]
+		if !ok || schema.Properties[t.Discriminator] != nil {
+			continue
+		}
+		schema.Properties[t.Discriminator] = &openAPISchema{
+			Type: "string",
+			Enum: []string{v},
+		}
+	}
+}
+
+// addOpenAPIConstraints adds the length and range constraints of a Sysl type
+// to its schema
+func addOpenAPIConstraints(schema *openAPISchema, t *pb.Type) {
+	for _, c := range t.Constraint {
+		if l := c.GetLength(); l != nil {
+			if l.Min > 0 {
+				schema.MinLength = &l.Min
+			}
+			if l.Max > 0 {
+				schema.MaxLength = &l.Max
+			}
+		}
+		if r := c.GetRange(); r != nil {
+			if min := json.Number(getValueLiteral(r.Min)); min != "" {
+				schema.Minimum = &min
+			}
+			if max := json.Number(getValueLiteral(r.Max)); max != "" {
+				schema.Maximum = &max
+			}
+		}
+	}
+}
+
+// getOpenAPISchema creates the OpenAPI schema for a Sysl type already
+// validated with GetType
+func getOpenAPISchema(t *pb.Type) *openAPISchema {
+	switch {
+	case t.GetList() != nil:
+		items := getOpenAPISchema(t.GetList().GetType())
+		return &openAPISchema{Type: "array", Items: items}
+	case t.GetSet() != nil:
+		// sets are generated as map[T]interface{}
+		return &openAPISchema{Type: "object", AdditionalProperties: &openAPISchema{}}
+	case t.GetTypeRef() != nil:
+		return getOpenAPITypeNameSchema(t.GetTypeRef().GetRef().GetPath()[0])
+	}
+	name := strings.ToLower(t.GetPrimitive().String())
+	schema := openAPIPrimitives[name]
+	return &schema
+}
+
+// getOpenAPITypeNameSchema creates the OpenAPI schema for a Sysl primitive
+// type name, a "map of K:V" or a type reference
+func getOpenAPITypeNameSchema(name string) *openAPISchema {
+	if schema, ok := openAPIPrimitives[name]; ok {
+		return &schema
+	}
+	if strings.HasPrefix(name, "map of") {
+		m := strings.Split(strings.TrimPrefix(name, "map of"), ":")
+		value := strings.TrimSpace(m[len(m)-1])
+		additional := getOpenAPITypeNameSchema(value)
+		return &openAPISchema{Type: "object", AdditionalProperties: additional}
+	}
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
@@ -0,0 +1,156 @@
+package gosysl
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+	"github.com/golang/protobuf/proto"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestWriteOpenAPI(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+	data, err := ioutil.ReadFile("example/example.pb")
+	assert.NoError(err)
+	module := &pb.Module{}
+	assert.NoError(proto.Unmarshal(data, module))
+	app := module.Apps["RestApi"]
+
+	w := &bytes.Buffer{}
+	assert.NoError(WriteOpenAPI(w, app, sortEpNames(app.Endpoints)))
+	doc := openAPI{}
+	assert.NoError(json.Unmarshal(w.Bytes(), &doc))
+	assert.Equal("3.0.0", doc.OpenAPI)
+	assert.Equal("RestApi", doc.Info.Title)
+	assert.Len(doc.Paths, 12)
+
+	getData := doc.Paths["/api/{key}"]["get"]
+	assert.Equal("GetData", getData.OperationID)
+	assert.Equal("Data", getData.Description)
+	expectedParams := []*openAPIParameter{
+		{Name: "key", In: "path", Required: true, Schema: &openAPISchema{Type: "string"}},
+		{Name: "time", In: "query", Required: true, Schema: &openAPISchema{Type: "string"}},
+	}
+	assert.Equal(expectedParams, getData.Parameters)
+	ref := &openAPISchema{Ref: "#/components/schemas/Data"}
+	assert.Equal(ref, getData.Responses["200"].Content["application/json"].Schema)
+	assert.Nil(getData.RequestBody)
+
+	post := doc.Paths["/api"]["post"]
+	ref = &openAPISchema{Ref: "#/components/schemas/DataSetPayload"}
+	assert.Equal(ref, post.RequestBody.Content["application/json"].Schema)
+	assert.Contains(post.Responses, "201")
+
+	deleteData := doc.Paths["/api/{key}/{startTime}"]["delete"]
+	assert.Nil(deleteData.Responses["204"].Content)
+	problem := deleteData.Responses["default"].Content["application/problem+json"]
+	assert.Equal(&openAPISchema{Ref: "#/components/schemas/Problem"}, problem.Schema)
+	assert.Equal(getOpenAPIProblemSchema(), doc.Components.Schemas["Problem"])
+
+	schema := doc.Components.Schemas["DataSetPayload"]
+	assert.Equal("object", schema.Type)
+	assert.Equal(
+		"DataSetPayload is JSON payload on REST API request to create new data set",
+		schema.Description,
+	)
+	assert.Equal(&openAPISchema{Type: "string"}, schema.Properties["start-time"])
+	assert.Equal(&openAPISchema{}, schema.Properties["schema"])
+	assert.Equal([]string{"name", "schema", "start-time"}, schema.Required)
+
+	schema = doc.Components.Schemas["CreationTimes"]
+	ref = &openAPISchema{Ref: "#/components/schemas/CreationStartTime"}
+	expected := &openAPISchema{Type: "object", AdditionalProperties: ref}
+	assert.Equal(expected, schema.Properties["data"])
+
+	schema = doc.Components.Schemas["Restriction"]
+	expected = &openAPISchema{Type: "array", Items: &openAPISchema{Type: "string"}}
+	assert.Equal(expected, schema.Properties["read-scopes"])
+}
+
+func TestGetOpenAPISchema(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dateType := &pb.Type{Type: &pb.Type_Primitive_{Primitive: pb.Type_DATETIME}}
+	expected := &openAPISchema{Type: "string", Format: "date-time"}
+	assert.Equal(expected, getOpenAPISchema(dateType))
+
+	setType := &pb.Type{Type: &pb.Type_Set{Set: dateType}}
+	expected = &openAPISchema{Type: "object", AdditionalProperties: &openAPISchema{}}
+	assert.Equal(expected, getOpenAPISchema(setType))
+
+	expected = &openAPISchema{
+		Type:                 "object",
+		AdditionalProperties: &openAPISchema{Type: "integer"},
+	}
+	assert.Equal(expected, getOpenAPITypeNameSchema("map of string:int"))
+
+	stringType := pbtest.NewPrimitiveType(1, pb.Type_STRING)
+	length := &pb.Type_Constraint_Length{Min: 1, Max: 10}
+	rng := &pb.Type_Constraint_Range{Max: &pb.Value{Value: &pb.Value_D{D: 1.5}}}
+	stringType.Constraint = []*pb.Type_Constraint{{Length: length}, {Range: rng}}
+	schema := getOpenAPISchema(stringType)
+	addOpenAPIConstraints(schema, stringType)
+	b, err := json.Marshal(schema)
+	assert.NoError(err)
+	expectedJSON := `{"type":"string","minLength":1,"maxLength":10,"maximum":1.5}`
+	assert.Equal(expectedJSON, string(b))
+}
+
+func TestOpenAPICornerCases(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	w := &bytes.Buffer{}
+	ep := &pb.Endpoint{Name: "BADMETHOD ep"}
+	app := &pb.Application{Endpoints: map[string]*pb.Endpoint{"BADMETHOD ep": ep}}
+	assert.Error(WriteOpenAPI(w, app, []string{"BADMETHOD ep"}))
+
+	ep = &pb.Endpoint{Name: "GET ep"}
+	app = &pb.Application{Endpoints: map[string]*pb.Endpoint{"GET ep": ep}}
+	_, err := genOpenAPIFile(app, []string{"GET ep"})
+	assert.Error(err)
+
+	app = &pb.Application{Types: map[string]*pb.Type{"x": {}}}
+	assert.Error(WriteOpenAPI(w, app, nil))
+
+	attrDefs := map[string]*pb.Type{"Data": {}}
+	typeTuple := &pb.Type_Tuple_{Tuple: &pb.Type_Tuple{AttrDefs: attrDefs}}
+	app = &pb.Application{Types: map[string]*pb.Type{"x": {Type: typeTuple}}}
+	assert.Error(WriteOpenAPI(w, app, nil))
+}
+
+func TestOpenAPIUnion(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := newUnionApp()
+	app.Types["Pet"].Attrs = map[string]*pb.Attribute{"doc": pbtest.NewStringAttr("A pet")}
+	types, err := model.NewTypes(app)
+	assert.NoError(err)
+	schemas := getOpenAPISchemas(types)
+	expected := &openAPISchema{
+		Description: "A pet",
+		OneOf: []*openAPISchema{
+			{Ref: "#/components/schemas/Cat"},
+			{Ref: "#/components/schemas/Dog"},
+		},
+		Discriminator: &openAPIDiscriminator{
+			PropertyName: "type",
+			Mapping: map[string]string{
+				"Cat": "#/components/schemas/Cat",
+				"Dog": "#/components/schemas/Dog",
+			},
+		},
+	}
+	assert.Equal(expected, schemas["Pet"])
+	discriminator := &openAPISchema{Type: "string", Enum: []string{"Dog"}}
+	assert.Equal(discriminator, schemas["Dog"].Properties["type"])
+	assert.NotContains(schemas["Dog"].Required, "type")
+
+	app.Types["Pet"] = newUnionType(3, "int")
+	_, err = model.NewTypes(app)
+	assert.Error(err)
+}
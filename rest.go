@@ -3,294 +3,317 @@ package gosysl
 import (
 	"fmt"
 	"io"
+	"net/http"
+	"strconv"
 	"strings"
 
+	"github.com/anz-bank/gosysl/model"
 	"github.com/anz-bank/gosysl/pb"
 )
 
-type route struct {
-	methods         map[string]string
-	middleware      string
-	keys            []string
-	queryParams     map[string][]string
-	postPayloadType string
-	putPayloadType  string
+// routes is the API model of the REST endpoints with the router backend
+// serving them
+type routes struct {
+	*model.API
+	router routerBackend
 }
 
-type routes struct {
-	paths   []string
-	content map[string]*route
+// WriteMiddleware writes interface returning required middleware functions
+// for REST endpoints with the middleware template
+func WriteMiddleware(w io.Writer, app *pb.Application, epNames []string) error {
+	tmpl, err := getTemplates(app)
+	if err != nil {
+		return err
+	}
+	return tmpl.ExecuteTemplate(w, "middleware", model.GetMiddleware(app, epNames))
 }
 
-var validHTTPMethods = map[string]struct{}{
-	"GET":    {},
-	"PUT":    {},
-	"POST":   {},
-	"DELETE": {},
+// restData is the template data of the REST handler
+type restData struct {
+	ContextKeys []string
+	Routes      []routeData
+	Handlers    []handlerData
 }
 
-// WriteMiddleware writes interface returning required middleware functions
-// for REST endpoints
-func WriteMiddleware(w io.Writer, app *pb.Application, epNames []string) {
-	middlewares := make([]string, 0, len(epNames))
-	middlewareSet := make(map[string]struct{}, len(epNames))
-	for _, name := range epNames {
-		if m, ok := app.Endpoints[name].Attrs["middleware"]; ok {
-			if _, ok2 := middlewareSet[m.GetS()]; !ok2 {
-				middlewareSet[m.GetS()] = struct{}{}
-				middlewares = append(middlewares, m.GetS())
-			}
+// HasRouteMiddleware reports whether any route has path parameters or
+// middleware
+func (d restData) HasRouteMiddleware() bool {
+	for _, r := range d.Routes {
+		if r.HasMiddleware() {
+			return true
 		}
 	}
+	return false
+}
 
-	fmt.Fprintln(w, `// Middleware holds the middleware accessor methods for the REST API`)
-	fmt.Fprintln(w, `type Middleware interface {`)
-	for _, m := range middlewares {
-		fmt.Fprintf(w, "%s() []func(next http.Handler) http.Handler\n", m)
-	}
-	fmt.Fprintln(w, "Root() []func(next http.Handler) http.Handler")
-	fmt.Fprintln(w, `}`)
+// routeData is the template data of a route path with its methods in
+// model.Methods order and the methods of its Allow header
+type routeData struct {
+	Path       string
+	Middleware string
+	PathParams []paramData
+	Methods    []routeMethodData
+	Allow      []string
+}
+
+// HasMiddleware reports whether the handlers of the route are wrapped in
+// context savers or middleware
+func (d routeData) HasMiddleware() bool {
+	return len(d.PathParams) > 0 || d.Middleware != ""
+}
+
+// routeMethodData is the template data of a method of a route and the name of
+// its handler
+type routeMethodData struct {
+	Method  string
+	Handler string
+}
+
+// handlerData is the template data of the handler of an endpoint, Name is the
+// Storer method, Result its result type if any and Status the success status
+type handlerData struct {
+	Name       string
+	PathParams []paramData
+	Params     []paramData
+	HasPayload bool
+	MergePatch bool
+	Payload    string
+	Args       []string
+	Result     string
+	Status     int
+}
+
+// paramData is the template data of a request parameter. Value is the Go
+// expression of its string value, Values of all its string values.
+type paramData struct {
+	Name       string
+	Var        string
+	ContextKey string
+	ParseFunc  string
+	DeclType   string
+	Values     string
+	Value      string
+	Default    string
+	List       bool
+	Optional   bool
+	// Required is set for query, header and cookie parameters that are
+	// neither optional nor have a default
+	Required bool
 }
 
 // WriteRest creates the contextkeys, routes and handlers for actual REST handlers
 func WriteRest(w io.Writer, app *pb.Application, epNames []string) error {
-	writeContextKeys(w, app, epNames)
-	r, err := getRoutes(app, epNames)
+	rs, err := getRoutes(app, epNames)
 	if err != nil {
 		return err
 	}
-	writeNewRestHandler(w, r)
-	writeHandlers(w, r)
-	return nil
-}
-
-func writeHandlers(w io.Writer, rs routes) {
-	for _, path := range rs.paths {
-		r := rs.content[path]
-		if handler, ok := r.methods["GET"]; ok {
-			writeGet(w, handler, r)
-		}
-		if handler, ok := r.methods["POST"]; ok {
-			writePost(w, handler, r)
-		}
-		if handler, ok := r.methods["PUT"]; ok {
-			writePut(w, handler, r)
-		}
-		if handler, ok := r.methods["DELETE"]; ok {
-			writeDelete(w, handler, r)
+	if err := rs.router.checkRoutes(rs); err != nil {
+		return err
+	}
+	tmpl, err := getTemplates(app)
+	if err != nil {
+		return err
+	}
+	if tmpl, err = getBackendTemplates(tmpl, rs.router); err != nil {
+		return err
+	}
+	var data restData
+	for _, key := range getContextKeys(rs.API) {
+		data.ContextKeys = append(data.ContextKeys, getContextKey(key))
+	}
+	for _, path := range rs.Paths {
+		data.Routes = append(data.Routes, getRouteData(path))
+		for _, op := range path.Operations {
+			data.Handlers = append(data.Handlers,
+				getHandlerData(op, HasContext(app)))
 		}
 	}
+	return tmpl.ExecuteTemplate(w, "rest", data)
 }
 
-func writeHandlerHead(w io.Writer, handler string, keys []string, queryParams []string) {
-	format := "func (rh *RestHandler) handle%s(w http.ResponseWriter, r *http.Request) {\n"
-	fmt.Fprintf(w, format, handler)
-	for _, key := range keys {
-		format = "	%s := r.Context().Value(%s).(string)\n"
-		fmt.Fprintf(w, format, key, getContextKey(key))
+func getRouteData(path *model.Path) routeData {
+	data := routeData{Path: path.Path, Middleware: path.Middleware}
+	for _, p := range path.PathParams {
+		data.PathParams = append(data.PathParams, getParamData(p))
 	}
-	for _, qp := range queryParams {
-		format = "	%s := r.URL.Query().Get(\"%s\")\n"
-		fmt.Fprintf(w, format, qp, qp)
+	for _, op := range path.Operations {
+		data.Methods = append(data.Methods, routeMethodData{op.Method, op.Name})
 	}
+	for _, m := range allowMethods {
+		if path.Operation(getHandlerMethod(m)) != nil {
+			data.Allow = append(data.Allow, m)
+		}
+	}
+	data.Allow = append(data.Allow, "OPTIONS")
+	return data
 }
 
-const errBoiler = `if err != nil {
-		http.Error(w, err.Error(), getStatus(err))
-		return
-	}`
-
-func writeGet(w io.Writer, handler string, r *route) {
-	writeHandlerHead(w, handler, r.keys, r.queryParams["GET"])
-	params := strings.Join(append(r.keys, r.queryParams["GET"]...), ", ")
-	s := `	result, err := rh.storer.%s(%s)
-	%s
-	render.JSON(w, r, result)
-}` + "\n\n"
-	fmt.Fprintf(w, s, handler, params, errBoiler)
-}
-
-func writeDelete(w io.Writer, handler string, r *route) {
-	writeHandlerHead(w, handler, r.keys, r.queryParams["DELETE"])
-	params := strings.Join(append(r.keys, r.queryParams["DELETE"]...), ", ")
-	s := `	if err := rh.storer.%s(%s); err != nil {
-		http.Error(w, err.Error(), getStatus(err))
-		return
+func getHandlerData(op *model.Operation, withContext bool) handlerData {
+	data := handlerData{
+		Name:       op.Name,
+		HasPayload: op.HasBody(),
+		MergePatch: op.Method == "PATCH",
+		Args:       getArgs(op, withContext),
+		Result:     op.Response.Type,
+		Status:     op.Response.Status,
+	}
+	if op.Payload != nil {
+		data.Payload = op.Payload.Type
+	}
+	for _, p := range op.PathParams() {
+		data.PathParams = append(data.PathParams, getParamData(p))
 	}
-	render.NoContent(w, r)
-}` + "\n\n"
-	fmt.Fprintf(w, s, handler, params)
+	for _, p := range op.RequestParams() {
+		data.Params = append(data.Params, getParamData(p))
+	}
+	return data
 }
 
-const payloadBoiler = `	if err := decodeJSON(r.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}` + "\n"
-
-func writePut(w io.Writer, handler string, r *route) {
-	writeHandlerHead(w, handler, r.keys, r.queryParams["PUT"])
-	p := append(r.keys, r.queryParams["PUT"]...)
-	p = append(p, "payload")
-	params := strings.Join(p, ", ")
-	s := `	var payload %s
-	%s
-	result, err := rh.storer.%s(%s)
-	%s
-	render.JSON(w, r, result)
-}` + "\n\n"
-	fmt.Fprintf(w, s, r.putPayloadType, payloadBoiler, handler, params, errBoiler)
+func getParamData(p *model.Param) paramData {
+	data := paramData{
+		Name:      p.Name,
+		Var:       p.Var,
+		ParseFunc: getParamCodec(p).parseFunc,
+		DeclType:  p.DeclType(),
+		Default:   p.Default,
+		List:      p.List,
+		Optional:  p.Optional,
+		Required:  p.In != model.InPath && !p.Optional && p.Default == "",
+	}
+	switch {
+	case p.In == model.InPath:
+		data.ContextKey = getContextKey(p.Name)
+		data.Value = fmt.Sprintf("r.Context().Value(%s).(string)", data.ContextKey)
+	case p.Default != "":
+		data.Values = getValuesExpr(p)
+		data.Value = fmt.Sprintf("firstValue(%s, %q)", data.Values, p.Default)
+	default:
+		data.Values, data.Value = getValuesExpr(p), getValueExpr(p)
+	}
+	return data
 }
 
-func writePost(w io.Writer, handler string, r *route) {
-	writeHandlerHead(w, handler, r.keys, r.queryParams["POST"])
-	p := append(r.keys, r.queryParams["POST"]...)
-	p = append(p, "payload")
-	params := strings.Join(p, ", ")
-
-	s := `	var payload %s
-	%s
-	result, err := rh.storer.%s(%s)
-	%s
-	render.Status(r, http.StatusCreated)
-	render.JSON(w, r, result)
-}` + "\n\n"
-	fmt.Fprintf(w, s, r.postPayloadType, payloadBoiler, handler, params, errBoiler)
+// getArgs returns the handler variables passed to the Storer by the handler of
+// an operation
+func getArgs(op *model.Operation, withContext bool) []string {
+	args := make([]string, 0, len(op.Params)+2)
+	if withContext {
+		args = append(args, "r.Context()")
+	}
+	for _, p := range op.Params {
+		args = append(args, p.Var)
+	}
+	if op.HasBody() {
+		args = append(args, "payload")
+	}
+	return args
 }
 
-func writeNewRestHandler(w io.Writer, r routes) {
-	fmt.Fprint(w, `// NewRestHandler creates a new Handler persisting data to Storer.
-func NewRestHandler(s Storer, m Middleware) RestHandler {
-	r := chi.NewRouter()
-	r.Use(m.Root()...)
-	rh := RestHandler{s, r}`+"\n\n")
-	writeRoutes(w, r)
-	fmt.Fprint(w, "return rh \n} \n\n")
+// statusConsts holds the net/http constant names of success status codes
+var statusConsts = map[int]string{
+	http.StatusOK:                   "http.StatusOK",
+	http.StatusCreated:              "http.StatusCreated",
+	http.StatusAccepted:             "http.StatusAccepted",
+	http.StatusNonAuthoritativeInfo: "http.StatusNonAuthoritativeInfo",
+	http.StatusNoContent:            "http.StatusNoContent",
+	http.StatusResetContent:         "http.StatusResetContent",
+	http.StatusPartialContent:       "http.StatusPartialContent",
 }
 
-func writeRoutes(w io.Writer, r routes) {
-	for _, path := range r.paths {
-		fmt.Fprintf(w, `r.Route("%s", func(r chi.Router) {`+"\n", path)
-		for _, key := range r.content[path].keys {
-			ctxKey := getContextKey(key)
-			fmt.Fprintf(w, "r.Use(makeContextSaver(%s, \"%s\"))\n", ctxKey, key)
-		}
-		middleware := r.content[path].middleware
-		if middleware != "" {
-			fmt.Fprintf(w, "r.Use(m.%s()...)\n", middleware)
-		}
-		methods := r.content[path].methods
-		for _, m := range []string{"GET", "POST", "PUT", "DELETE"} {
-			handler, ok := methods[m]
-			if ok {
-				method := strings.Title(strings.ToLower(m))
-				fmt.Fprintf(w, "r.%s(\"/\", rh.handle%s)\n", method, handler)
-			}
-		}
-		fmt.Fprint(w, "})\n")
+// getStatusExpr returns the Go expression for a success status code
+func getStatusExpr(status int) string {
+	if c, ok := statusConsts[status]; ok {
+		return c
 	}
+	return strconv.Itoa(status)
 }
 
 func getRoutes(app *pb.Application, epNames []string) (routes, error) {
-	paths := make([]string, 0, len(epNames)/2)
-	content := make(map[string]*route, len(epNames)/2)
-	for _, name := range epNames {
-		fields := strings.Split(name, " ")
-		if len(fields) != 2 {
-			msg := `expect "GET|POST|etc path/path" as endpoint name (%s) `
-			return routes{}, fmt.Errorf(msg, name)
-		}
-		method := strings.ToUpper(fields[0])
-		if _, ok := validHTTPMethods[method]; !ok {
-			return routes{}, fmt.Errorf("invalid HTTP Method (%s)", method)
-		}
-		endpoint := app.Endpoints[name]
-		httpPath := fields[1]
-		if _, ok := content[httpPath]; !ok {
-			middleware := ""
-			if m, ok := endpoint.Attrs["middleware"]; ok {
-				middleware = m.GetS()
-			}
-			content[httpPath] = &route{
-				methods:     map[string]string{},
-				middleware:  middleware,
-				keys:        getPatternParams(endpoint),
-				queryParams: make(map[string][]string, 4),
-			}
-			paths = append(paths, httpPath)
-		}
-		interfaceMethod := GetMethodName(endpoint)
-		content[httpPath].methods[method] = interfaceMethod
-		content[httpPath].queryParams[method] = getQueryParams(endpoint)
-		if method == "PUT" {
-			t := getPayloadType(endpoint)
-			content[httpPath].putPayloadType = t
-		}
-		if method == "POST" {
-			content[httpPath].postPayloadType = getPayloadType(endpoint)
-		}
+	backend, err := getRouterBackend(app)
+	if err != nil {
+		return routes{}, err
+	}
+	api, err := model.New(app, epNames)
+	if err != nil {
+		return routes{}, err
 	}
-	return routes{paths, content}, nil
+	return routes{api, backend}, nil
 }
 
-func getPayloadType(ep *pb.Endpoint) string {
-	if len(ep.Param) != 1 || ep.Param[0].Type.GetTypeRef() == nil {
-		return ""
-	}
-	return ep.Param[0].Type.GetTypeRef().Ref.Appname.Part[0]
+func getContextKey(param string) string {
+	return strings.Title(param) + "Key"
 }
 
-func writeContextKeys(w io.Writer, app *pb.Application, epNames []string) {
-	keys := getContextKeys(app, epNames)
-	if len(keys) == 0 {
-		return
-	}
-	fmt.Fprintln(w, `// Keys for Context lookup`)
-	fmt.Fprintln(w, `const (`)
-	fmt.Fprintf(w, "%s ContextKeyType = iota\n", getContextKey(keys[0]))
-	for i := 1; i < len(keys); i++ {
-		fmt.Fprintln(w, getContextKey(keys[i]))
-	}
-	fmt.Fprintln(w, ")")
+// paramCodec holds the function parsing the string value of a parameter in
+// the handler and the format of the string value in the client with %s for
+// the variable. Strings are neither parsed nor formatted.
+type paramCodec struct {
+	parseFunc  string
+	formatExpr string
 }
 
-func getContextKey(param string) string {
-	return strings.Title(param) + "Key"
+// paramCodecs holds the codecs of the Sysl primitive types of parameters,
+// other type names are enums
+var paramCodecs = map[string]paramCodec{
+	"string":   {},
+	"int":      {"strconv.Atoi", "strconv.Itoa(%s)"},
+	"float":    {"parseFloat", "formatFloat(%s)"},
+	"decimal":  {"parseFloat", "formatFloat(%s)"},
+	"bool":     {"strconv.ParseBool", "strconv.FormatBool(%s)"},
+	"date":     {"parseDate", "formatDate(%s)"},
+	"datetime": {"parseDateTime", "formatDateTime(%s)"},
+	"uuid":     {parseFunc: "parseUUID"},
 }
 
-func getPatternParams(ep *pb.Endpoint) []string {
-	if ep == nil || ep.RestParams == nil {
-		return nil
+func getParamCodec(p *model.Param) paramCodec {
+	if c, ok := paramCodecs[p.TypeName]; ok {
+		return c
 	}
-	result := make([]string, 0, len(ep.RestParams.QueryParam))
-	for _, qp := range ep.RestParams.QueryParam {
-		if qp.Type.GetTypeRef() == nil {
-			result = append([]string{qp.Name}, result...)
-		}
+	return paramCodec{"Parse" + p.TypeName, "%s.String()"}
+}
+
+// formatParam returns the Go expression formatting a value of the parameter's
+// element type as string
+func formatParam(p *model.Param, value string) string {
+	formatExpr := getParamCodec(p).formatExpr
+	if formatExpr == "" {
+		return value
 	}
-	return result
+	return fmt.Sprintf(formatExpr, value)
 }
 
-func getQueryParams(ep *pb.Endpoint) []string {
-	if ep == nil || ep.RestParams == nil {
-		return nil
+// getValuesExpr returns the Go expression for all string values of a query,
+// header or cookie parameter in the handler
+func getValuesExpr(p *model.Param) string {
+	switch p.In {
+	case model.InHeader:
+		return fmt.Sprintf("r.Header[\"%s\"]", http.CanonicalHeaderKey(p.Name))
+	case model.InCookie:
+		return fmt.Sprintf("cookieValues(r, \"%s\")", p.Name)
 	}
-	result := make([]string, 0, len(ep.RestParams.QueryParam))
-	for _, qp := range ep.RestParams.QueryParam {
-		if qp.Type.GetTypeRef() != nil {
-			result = append(result, qp.Name)
-		}
+	return fmt.Sprintf("r.URL.Query()[\"%s\"]", p.Name)
+}
+
+// getValueExpr returns the Go expression for the first string value of a query,
+// header or cookie parameter in the handler, "" if missing
+func getValueExpr(p *model.Param) string {
+	switch p.In {
+	case model.InHeader:
+		return fmt.Sprintf("r.Header.Get(\"%s\")", p.Name)
+	case model.InCookie:
+		return fmt.Sprintf("firstValue(cookieValues(r, \"%s\"), \"\")", p.Name)
 	}
-	return result
+	return fmt.Sprintf("r.URL.Query().Get(\"%s\")", p.Name)
 }
 
-func getContextKeys(app *pb.Application, epNames []string) []string {
-	set := make(map[string]struct{}, len(epNames))
-	result := make([]string, 0, len(epNames))
-	for _, name := range epNames {
-		for _, qp := range getPatternParams(app.Endpoints[name]) {
-			if _, ok := set[qp]; !ok {
-				set[qp] = struct{}{}
-				result = append(result, qp)
+func getContextKeys(api *model.API) []string {
+	set := make(map[string]struct{}, len(api.Operations))
+	result := make([]string, 0, len(api.Operations))
+	for _, op := range api.Operations {
+		for _, p := range op.PathParams() {
+			if _, ok := set[p.Name]; !ok {
+				set[p.Name] = struct{}{}
+				result = append(result, p.Name)
 			}
 		}
 	}
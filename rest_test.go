@@ -1,8 +1,12 @@
 package gosysl
 
 import (
+	"bytes"
+	"go/format"
 	"testing"
 
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/model"
 	"github.com/anz-bank/gosysl/pb"
 	testifyAssert "github.com/stretchr/testify/assert"
 )
@@ -27,7 +31,7 @@ func TestRestCornerCases(tt *testing.T) {
 		Endpoints: map[string]*pb.Endpoint{"ep": ep},
 	}
 	module := &pb.Module{Apps: map[string]*pb.Application{"app": app}}
-	_, err := Generate(module, "pkg")
+	_, err := Generate(module)
 	assert.Error(err)
 
 	_, err = genMiddlewareFile(&pb.Application{}, nil, "BAD PACKAGE")
@@ -57,9 +61,650 @@ func TestRestCornerCases(tt *testing.T) {
 	}
 	app = &pb.Application{Endpoints: map[string]*pb.Endpoint{"ep": ep}}
 	module = &pb.Module{Apps: map[string]*pb.Application{"app": app}}
-	_, err = Generate(module, "pkg")
+	_, err = Generate(module)
 	assert.Error(err)
 
-	assert.Equal("", getPayloadType(ep))
+	assert.Nil(model.GetPayload(ep))
 
 }
+
+func newPatchEndpoint() *pb.Endpoint {
+	line := &pb.SourceContext{Start: &pb.SourceContext_Location{Line: 1}}
+	keyType := &pb.Type{
+		Type:          &pb.Type_Primitive_{Primitive: pb.Type_STRING},
+		SourceContext: line,
+	}
+	appName := &pb.AppName{Part: []string{"DataPayload"}}
+	payloadRef := &pb.ScopedRef{Ref: &pb.Scope{Appname: appName}}
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Data"}}}
+	return &pb.Endpoint{
+		Name: "PATCH /api/{key}",
+		RestParams: &pb.Endpoint_RestParams{
+			QueryParam: []*pb.Endpoint_RestParams_QueryParam{{Name: "key", Type: keyType}},
+		},
+		Param: []*pb.Param{
+			{Name: "dp", Type: &pb.Type{Type: &pb.Type_TypeRef{TypeRef: payloadRef}}},
+		},
+		Stmt: []*pb.Statement{ret},
+	}
+}
+
+func TestWritePatch(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := newPatchEndpoint()
+	app := &pb.Application{Endpoints: map[string]*pb.Endpoint{ep.Name: ep}}
+	op, err := model.NewOperation(app, ep.Name)
+	assert.NoError(err)
+	assert.Equal("key string, dp MergePatch", getParams(op, false))
+
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, []string{ep.Name}))
+	expected := `	r.Route("/api/{key}", func(r chi.Router) {
+		r.Use(makeContextSaver(KeyKey, "key"))
+		r.Patch("/", rh.handlePatchApiKey)
+		r.Options("/", makeOptionsHandler("PATCH, OPTIONS"))
+	})
+	return rh
+}
+
+func (rh *RestHandler) handlePatchApiKey(w http.ResponseWriter, r *http.Request) {
+	key := r.Context().Value(KeyKey).(string)
+	var payload MergePatch
+	if _, err := decodeJSON(r.Body, &payload); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := payload.Check(); err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	result, err := rh.storer.PatchApiKey(key, payload)
+	if err != nil {
+		rh.encodeError(w, r, getStatus(err), err)
+		return
+	}
+	render.JSON(w, r, result)
+}
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), expected)
+
+	ep.Param = nil
+	assert.Error(WriteRest(w, app, []string{ep.Name}))
+}
+
+func TestPatchEnumUnion(tt *testing.T) {
+	ep := newPatchEndpoint()
+	ep.Name = "PATCH /data/{key}"
+	ep.Param[0].Type.GetTypeRef().Ref.Appname.Part = []string{"Data"}
+	app := newUnionApp()
+	app.Endpoints = map[string]*pb.Endpoint{ep.Name: ep}
+	app.Attrs = map[string]*pb.Attribute{"router": pbtest.NewStringAttr(RouterServeMux)}
+	app.Types["Kind"] = newEnumType(4, map[string]int64{"CAT": 1, "DOG": 2})
+	length := &pb.Type_Constraint_Length{Min: 1, Max: 5}
+	catName := app.Types["Cat"].GetTuple().AttrDefs["Name"]
+	catName.Constraint = []*pb.Type_Constraint{{Length: length}}
+	app.Types["Data"] = pbtest.NewLineType(5, pbtest.NewTupleType(map[string]*pb.Type{
+		"Kind": pbtest.NewRefType(5, "Kind"),
+		"Pet":  pbtest.NewRefType(6, "Pet"),
+	}))
+	runGenerated(tt, app, patchEnumUnionTest)
+}
+
+const patchEnumUnionTest = `package gen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type storer struct{ data Data }
+
+func (s *storer) PatchDataKey(key string, dp MergePatch) (Data, error) {
+	data := s.data
+	if err := dp.Apply(&data); err != nil {
+		return Data{}, err
+	}
+	s.data = data
+	return data, nil
+}
+
+type middleware struct{}
+
+func (middleware) Root() []func(http.Handler) http.Handler { return nil }
+
+func patch(h http.Handler, body string) int {
+	return patchResponse(h, body).Code
+}
+
+func patchResponse(h http.Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("PATCH", "/data/1", strings.NewReader(body)))
+	return w
+}
+
+func TestPatch(t *testing.T) {
+	s := &storer{Data{Kind: KindCat, Pet: Pet{Cat: &Cat{Name: "Tom"}}}}
+	h := NewRestHandler(s, middleware{})
+	body := ` + "`" + `{"Kind": "DOG", "Pet": {"type": "Dog", "Breed": "Pug"}}` + "`" + `
+	if code := patch(&h, body); code != 200 {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if s.data.Kind != KindDog || s.data.Pet.Dog == nil || s.data.Pet.Dog.Breed != "Pug" {
+		t.Errorf("unexpected data %+v", s.data)
+	}
+	if code := patch(&h, "[1]"); code != 400 {
+		t.Errorf("unexpected status %d for array patch", code)
+	}
+	if code := patch(&h, "null"); code != 400 {
+		t.Errorf("unexpected status %d for null patch", code)
+	}
+	if code := patch(&h, ` + "`" + `{"Kind": 5}` + "`" + `); code != 400 {
+		t.Errorf("unexpected status %d for invalid patched value", code)
+	}
+	// patched documents are validated like payloads
+	for _, body := range []string{
+		` + "`" + `{"Pet": {"type": "Cat", "Name": "Garfield"}}` + "`" + `,
+		` + "`" + `{"Pet": {"type": "Cat"}}` + "`" + `,
+	} {
+		w := patchResponse(&h, body)
+		if w.Code != 400 || !strings.Contains(w.Body.String(), "invalid_payload") {
+			t.Errorf("unexpected response %d for %s: %s", w.Code, body, w.Body)
+		}
+	}
+}
+`
+
+func TestEnumQueryParam(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Path: []string{"{want<:Status}"}}}
+	qp := &pb.Endpoint_RestParams_QueryParam{
+		Name: "want",
+		Type: pbtest.NewLineType(1, &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}}),
+	}
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Status"}}}
+	params := []*pb.Endpoint_RestParams_QueryParam{qp}
+	ep := &pb.Endpoint{
+		Name:       "GET /status",
+		RestParams: &pb.Endpoint_RestParams{QueryParam: params},
+		Stmt:       []*pb.Statement{ret},
+	}
+	app := &pb.Application{
+		Endpoints: map[string]*pb.Endpoint{ep.Name: ep},
+		Types:     map[string]*pb.Type{"Status": newEnumType(1, map[string]int64{"A": 1})},
+	}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, []string{ep.Name}))
+	expected := "func (rh *RestHandler) handleGetStatus(" +
+		`w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.Query()["want"]) == 0 {
+		err := errors.New("missing parameter want")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	want, err := ParseStatus(r.URL.Query().Get("want"))
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	result, err := rh.storer.GetStatus(want)
+`
+	assert.Contains(w.String(), expected)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteClient(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), "q.Set(\"want\", want.String())\n")
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteValidate(w, app))
+	assert.Empty(w.String())
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteOpenAPI(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), `"Status": {
+        "type": "string",
+        "enum": [
+          "A"
+        ]
+      }`)
+}
+
+func TestTypedParams(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	newCurlyParam := func(name, curly string) *pb.Endpoint_RestParams_QueryParam {
+		ref := &pb.ScopedRef{Ref: &pb.Scope{Path: []string{curly}}}
+		t := pbtest.NewLineType(1, &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}})
+		return &pb.Endpoint_RestParams_QueryParam{Name: name, Type: t}
+	}
+	id := &pb.Endpoint_RestParams_QueryParam{
+		Name: "id",
+		Type: pbtest.NewPrimitiveType(1, pb.Type_INT),
+	}
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Item"}}}
+	params := []*pb.Endpoint_RestParams_QueryParam{
+		id,
+		newCurlyParam("since", "{since<:date}"),
+		newCurlyParam("ref", "{ref<:uuid}"),
+		newCurlyParam("q", "{query<:string}"),
+	}
+	ep := &pb.Endpoint{
+		Name:       "GET /items/{id}",
+		RestParams: &pb.Endpoint_RestParams{QueryParam: params},
+		Stmt:       []*pb.Statement{ret},
+	}
+	app := &pb.Application{Endpoints: map[string]*pb.Endpoint{ep.Name: ep}}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, []string{ep.Name}))
+	expected := "func (rh *RestHandler) handleGetItemsId(" +
+		`w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.Context().Value(IdKey).(string))
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(r.URL.Query()["since"]) == 0 {
+		err := errors.New("missing parameter since")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	since, err := parseDate(r.URL.Query().Get("since"))
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(r.URL.Query()["ref"]) == 0 {
+		err := errors.New("missing parameter ref")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	ref, err := parseUUID(r.URL.Query().Get("ref"))
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(r.URL.Query()["q"]) == 0 {
+		err := errors.New("missing parameter q")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	query := r.URL.Query().Get("q")
+	result, err := rh.storer.GetItemsId(id, since, ref, query)
+`
+	assert.Contains(w.String(), expected)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteInterface(w, app, []string{ep.Name}))
+	signature := "GetItemsId(id int, since time.Time, ref string, query string) " +
+		"(Item, error)"
+	assert.Contains(w.String(), signature)
+	assert.Equal([]string{"time"}, getInterfaceImports(app, []string{ep.Name}))
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteClient(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), "q.Set(\"since\", formatDate(since))\n")
+	assert.Contains(w.String(), "q.Set(\"ref\", ref)\n")
+	assert.Contains(w.String(), "q.Set(\"q\", query)\n")
+	assert.Contains(w.String(), `"/items/" + url.PathEscape(strconv.Itoa(id))`)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteOpenAPI(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), `"name": "id",
+            "in": "path",
+            "required": true,
+            "schema": {
+              "type": "integer"
+            }`)
+	assert.Contains(w.String(), `"schema": {
+              "type": "string",
+              "format": "uuid"
+            }`)
+
+	params[1] = newCurlyParam("since", "{since<:Item}")
+	assert.Error(WriteRest(w, app, []string{ep.Name}))
+	params[0] = &pb.Endpoint_RestParams_QueryParam{Name: "id", Type: &pb.Type{}}
+	assert.Error(WriteRest(w, app, []string{ep.Name}))
+}
+
+func TestListOptionalQueryParams(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	newCurlyParam := func(name, curly string) *pb.Endpoint_RestParams_QueryParam {
+		ref := &pb.ScopedRef{Ref: &pb.Scope{Path: []string{curly}}}
+		t := pbtest.NewLineType(1, &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}})
+		return &pb.Endpoint_RestParams_QueryParam{Name: name, Type: t}
+	}
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Items"}}}
+	params := []*pb.Endpoint_RestParams_QueryParam{
+		newCurlyParam("tag", "{tags<:sequence of string}"),
+		newCurlyParam("id", "{ids <: sequence of int}"),
+		newCurlyParam("limit", "{limit<:int?}"),
+		newCurlyParam("q", "{query<:string?}"),
+		newCurlyParam("page", "{page<:int}"),
+	}
+	ep := &pb.Endpoint{
+		Name:       "GET /items",
+		Attrs:      map[string]*pb.Attribute{"default_page": pbtest.NewStringAttr("1")},
+		RestParams: &pb.Endpoint_RestParams{QueryParam: params},
+		Stmt:       []*pb.Statement{ret},
+	}
+	app := &pb.Application{Endpoints: map[string]*pb.Endpoint{ep.Name: ep}}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, []string{ep.Name}))
+	expected := "func (rh *RestHandler) handleGetItems(" +
+		`w http.ResponseWriter, r *http.Request) {
+	if len(r.URL.Query()["tag"]) == 0 {
+		err := errors.New("missing parameter tag")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	tags := r.URL.Query()["tag"]
+	if len(r.URL.Query()["id"]) == 0 {
+		err := errors.New("missing parameter id")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	var ids []int
+	for _, s := range r.URL.Query()["id"] {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			rh.encodeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		ids = append(ids, v)
+	}
+	var limit *int
+	if values := r.URL.Query()["limit"]; len(values) > 0 {
+		v, err := strconv.Atoi(values[0])
+		if err != nil {
+			rh.encodeError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		limit = &v
+	}
+	var query *string
+	if values := r.URL.Query()["q"]; len(values) > 0 {
+		query = &values[0]
+	}
+	page, err := strconv.Atoi(firstValue(r.URL.Query()["page"], "1"))
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	result, err := rh.storer.GetItems(tags, ids, limit, query, page)
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), expected)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteInterface(w, app, []string{ep.Name}))
+	signature := "GetItems(tags []string, ids []int, limit *int, query *string, page int)"
+	assert.Contains(w.String(), signature)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteClient(w, app, []string{ep.Name}))
+	expected = `	q := url.Values{}
+	for _, v := range tags {
+		q.Add("tag", v)
+	}
+	for _, v := range ids {
+		q.Add("id", strconv.Itoa(v))
+	}
+	if limit != nil {
+		q.Set("limit", strconv.Itoa(*limit))
+	}
+	if query != nil {
+		q.Set("q", *query)
+	}
+	q.Set("page", strconv.Itoa(page))
+`
+	actual, err = format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), expected)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteOpenAPI(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), `"schema": {
+              "type": "array",
+              "items": {
+                "type": "integer"
+              }
+            }`)
+	assert.Contains(w.String(), `"schema": {
+              "type": "integer",
+              "default": 1
+            }`)
+
+	ep.Attrs["default_page"] = pbtest.NewStringAttr("first")
+	assert.Error(WriteRest(w, app, []string{ep.Name}))
+	ep.Attrs = map[string]*pb.Attribute{"default_tag": pbtest.NewStringAttr("a")}
+	assert.Error(WriteRest(w, app, []string{ep.Name}))
+}
+
+func TestHeaderCookieParams(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Item"}}}
+	elts := []*pb.Attribute{
+		pbtest.NewStringAttr("X-Request-ID"),
+		pbtest.NewStringAttr("If-Match={ifMatch <: string?}"),
+		pbtest.NewStringAttr("X-Version={version <: int}"),
+	}
+	arrayAttr := &pb.Attribute{Attribute: &pb.Attribute_A{A: &pb.Attribute_Array{Elt: elts}}}
+	ep := &pb.Endpoint{
+		Name: "GET /item",
+		Attrs: map[string]*pb.Attribute{
+			"headers":           arrayAttr,
+			"cookies":           pbtest.NewStringAttr("session"),
+			"default_X-Version": pbtest.NewStringAttr("2"),
+		},
+		Stmt: []*pb.Statement{ret},
+	}
+	app := &pb.Application{Endpoints: map[string]*pb.Endpoint{ep.Name: ep}}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, []string{ep.Name}))
+	expected := `	if len(r.Header["X-Request-Id"]) == 0 {
+		err := errors.New("missing parameter X-Request-ID")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	xRequestID := r.Header.Get("X-Request-ID")
+	var ifMatch *string
+	if values := r.Header["If-Match"]; len(values) > 0 {
+		ifMatch = &values[0]
+	}
+	version, err := strconv.Atoi(firstValue(r.Header["X-Version"], "2"))
+	if err != nil {
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if len(cookieValues(r, "session")) == 0 {
+		err := errors.New("missing parameter session")
+		rh.encodeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	session := firstValue(cookieValues(r, "session"), "")
+	result, err := rh.storer.GetItem(xRequestID, ifMatch, version, session)
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), expected)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteInterface(w, app, []string{ep.Name}))
+	signature := "GetItem(xRequestID string, ifMatch *string, version int, session string)"
+	assert.Contains(w.String(), signature)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteClient(w, app, []string{ep.Name}))
+	expected = `	h := http.Header{}
+	h.Set("X-Request-ID", xRequestID)
+	if ifMatch != nil {
+		h.Set("If-Match", *ifMatch)
+	}
+	h.Set("X-Version", strconv.Itoa(version))
+	h.Add("Cookie", (&http.Cookie{Name: "session", Value: session}).String())
+	var result Item
+	err := c.do(context.Background(), "GET", "/item", nil, h, nil, &result)
+`
+	actual, err = format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), expected)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteOpenAPI(w, app, []string{ep.Name}))
+	assert.Contains(w.String(), `"name": "If-Match",
+            "in": "header",
+            "schema"`)
+	assert.Contains(w.String(), `"name": "session",
+            "in": "cookie",
+            "required": true,`)
+
+	app.Attrs = map[string]*pb.Attribute{"router": pbtest.NewStringAttr(RouterServeMux)}
+	item := pbtest.NewTupleType(map[string]*pb.Type{
+		"Name": pbtest.NewPrimitiveType(1, pb.Type_STRING),
+	})
+	app.Types = map[string]*pb.Type{"Item": pbtest.NewLineType(1, item)}
+	runGenerated(tt, app, requiredParamsTest)
+
+	ep.Attrs["cookies"] = pbtest.NewStringAttr("session={sessions <: sequence of string}")
+	assert.Error(WriteRest(w, app, []string{ep.Name}))
+	ep.Attrs["cookies"] = pbtest.NewStringAttr("session={}")
+	assert.Error(WriteRest(w, app, []string{ep.Name}))
+}
+
+const requiredParamsTest = `package gen
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type storer struct{}
+
+func (storer) GetItem(xRequestID string, ifMatch *string, version int,
+	session string) (Item, error) {
+	return Item{}, nil
+}
+
+type middleware struct{}
+
+func (middleware) Root() []func(http.Handler) http.Handler { return nil }
+
+func TestRequiredParams(t *testing.T) {
+	h := NewRestHandler(storer{}, middleware{})
+	var tests = []struct {
+		header   string
+		cookie   string
+		expected string
+	}{
+		{"", "", "missing parameter X-Request-ID"},
+		{"1", "", "missing parameter session"},
+		{"1", "s", ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/item", nil)
+		if test.header != "" {
+			r.Header.Set("X-Request-ID", test.header)
+		}
+		if test.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: test.cookie})
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if test.expected == "" && w.Code != http.StatusOK ||
+			test.expected != "" && (w.Code != http.StatusBadRequest ||
+				!strings.Contains(w.Body.String(), test.expected)) {
+			t.Errorf("unexpected response %d: %s", w.Code, w.Body)
+		}
+	}
+}
+`
+
+func TestStatusCodes(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Appname: &pb.AppName{Part: []string{"Job"}}}}
+	param := &pb.Param{Name: "job", Type: &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}}}
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Job"}}}
+	noRet := &pb.Statement{Stmt: &pb.Statement_Action{Action: &pb.Action{Action: "return"}}}
+	post := &pb.Endpoint{
+		Name: "POST /jobs",
+		Attrs: map[string]*pb.Attribute{
+			"status":       {Attribute: &pb.Attribute_I{I: 202}},
+			"error_status": pbtest.NewStringAttr("409, 503"),
+		},
+		Param: []*pb.Param{param},
+		Stmt:  []*pb.Statement{ret},
+	}
+	del := &pb.Endpoint{Name: "DELETE /jobs", Stmt: []*pb.Statement{ret}}
+	put := &pb.Endpoint{
+		Name:  "PUT /jobs",
+		Attrs: map[string]*pb.Attribute{"status": pbtest.NewStringAttr("200")},
+		Param: []*pb.Param{param},
+		Stmt:  []*pb.Statement{noRet},
+	}
+	app := &pb.Application{Endpoints: map[string]*pb.Endpoint{
+		post.Name: post, del.Name: del, put.Name: put,
+	}}
+	epNames := []string{post.Name, put.Name, del.Name}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, epNames))
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), `	result, err := rh.storer.PostJobs(payload)
+	if err != nil {
+		rh.encodeError(w, r, getStatus(err), err)
+		return
+	}
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, result)
+}
+`)
+	assert.Contains(string(actual), `	if err := rh.storer.PutJobs(payload); err != nil {
+		rh.encodeError(w, r, getStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+`)
+	assert.Contains(string(actual), `	result, err := rh.storer.DeleteJobs()
+	if err != nil {
+		rh.encodeError(w, r, getStatus(err), err)
+		return
+	}
+	render.JSON(w, r, result)
+}
+`)
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteOpenAPI(w, app, epNames))
+	assert.Contains(w.String(), `"202": {
+            "description": "Accepted",`)
+	assert.Contains(w.String(), `"409": {
+            "description": "Conflict",`)
+	assert.Contains(w.String(), `"503": {
+            "description": "Service Unavailable",`)
+	assert.Contains(w.String(), `"delete": {
+        "operationId": "DeleteJobs",
+        "responses": {
+          "200": {
+            "description": "OK",`)
+
+	post.Attrs["status"] = pbtest.NewStringAttr("404")
+	assert.Error(WriteRest(w, app, epNames))
+	post.Attrs["status"] = pbtest.NewStringAttr("accepted")
+	assert.Error(WriteRest(w, app, epNames))
+	post.Attrs["status"] = pbtest.NewStringAttr("202")
+	post.Attrs["error_status"] = pbtest.NewStringAttr("404, 200")
+	assert.Error(WriteRest(w, app, epNames))
+}
@@ -0,0 +1,464 @@
+package gosysl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// HasRestTests reports whether conformance tests of the REST handler are
+// generated for an application, set with the app attribute rest_tests="true"
+func HasRestTests(app *pb.Application) bool {
+	return app.Attrs["rest_tests"].GetS() == "true"
+}
+
+// WriteRestTests creates a test per endpoint serving sample requests with
+// NewRestHandler and a stub Storer. The tests check routing, the extraction of
+// path parameters, payload decoding, the success status and the status of
+// errors returned by the Storer.
+func WriteRestTests(w io.Writer, app *pb.Application, epNames []string) error {
+	rs, err := getRoutes(app, epNames)
+	if err != nil {
+		return err
+	}
+	writeRestTestStorer(w, app, rs.API)
+	fmt.Fprintln(w, "// restTestMiddleware implements Middleware without middleware.")
+	fmt.Fprint(w, "type restTestMiddleware struct{}\n\n")
+	for _, m := range append(rs.Middleware, "Root") {
+		format := "func (restTestMiddleware) %s() []func(next http.Handler) http.Handler {\n"
+		fmt.Fprintf(w, format+"return nil\n}\n\n", m)
+	}
+	for _, path := range rs.Paths {
+		for i, op := range path.Operations {
+			if err := writeRestTest(w, op, rs, i == 0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeRestTestStorer writes restTestStorer implementing the Storer interface
+// by recording method name and arguments without context of the last call
+func writeRestTestStorer(w io.Writer, app *pb.Application, api *model.API) {
+	fmt.Fprintf(w, "var _ %s = (*restTestStorer)(nil)\n\n", getInterfaceName(app))
+	for _, op := range api.Operations {
+		names, _ := getParamDefs(op, false)
+		fmt.Fprintf(w, "func (stub *restTestStorer) %s(%s) %s {\n", op.Name,
+			getParams(op, HasContext(app)), getReturnTypes(op))
+		fmt.Fprintf(w, "stub.method, stub.args = \"%s\", []interface{}{%s}\n", op.Name,
+			strings.Join(names, ", "))
+		retType := op.Response.Type
+		if retType == "" {
+			fmt.Fprint(w, "return stub.err\n}\n\n")
+			continue
+		}
+		fmt.Fprintf(w, "var result %s\n", retType)
+		if sample, err := getSampleJSON(api.Types, retType); err == nil {
+			fmt.Fprintf(w, "decodeRestTestSample(%q, &result)\n", sample)
+		}
+		fmt.Fprint(w, "return result, stub.err\n}\n\n")
+	}
+}
+
+func writeRestTest(w io.Writer, op *model.Operation, rs routes, first bool) error {
+	name, method, path := op.Name, op.Method, op.Path
+	pathParams, params := op.PathParams(), op.RequestParams()
+	target, pathArgs, err := getRestTestTarget(rs.Types, path, pathParams, params, -1)
+	if err != nil {
+		return err
+	}
+	header, err := getRestTestHeader(rs.Types, params)
+	if err != nil {
+		return err
+	}
+	body := ""
+	switch method {
+	case "PATCH":
+		body = "{}"
+	case "POST", "PUT":
+		if op.Payload != nil && op.Payload.Type != "" {
+			sample, err := getSampleJSON(rs.Types, op.Payload.Type)
+			if err != nil {
+				return err
+			}
+			body = sample
+		}
+	}
+	status := getStatusExpr(op.Response.Status)
+	fmt.Fprintf(w, "func TestRest%s(t *testing.T) {\n", name)
+	fmt.Fprintln(w, "stub := &restTestStorer{}")
+	fmt.Fprintln(w, "h := NewRestHandler(stub, restTestMiddleware{})")
+	fmt.Fprintf(w, "target, header := %q, %s\n", target, header)
+	fmt.Fprintf(w, "w := serveRestTest(&h, \"%s\", target, %q, header)\n", method, body)
+	fmt.Fprintf(w, "checkRestTestStatus(t, w, %s)\n", status)
+	args := append([]string{`"` + name + `"`}, pathArgs...)
+	fmt.Fprintf(w, "checkRestTestCall(t, stub, %s)\n", strings.Join(args, ", "))
+	if method == "GET" {
+		fmt.Fprintln(w, "w = serveRestTest(&h, \"HEAD\", target, \"\", header)")
+		fmt.Fprintf(w, "checkRestTestStatus(t, w, %s)\n", status)
+	}
+	fmt.Fprintln(w, "\n// errors returned by the Storer")
+	fmt.Fprintln(w, "stub.err = &restTestError{http.StatusTeapot}")
+	fmt.Fprintf(w, "w = serveRestTest(&h, \"%s\", target, %q, header)\n", method, body)
+	fmt.Fprintln(w, "checkRestTestStatus(t, w, http.StatusTeapot)")
+	fmt.Fprintln(w, "stub.err = nil")
+	if body != "" {
+		fmt.Fprintln(w, "\n// payload decoding")
+		fmt.Fprintln(w, "stub.method = \"\"")
+		fmt.Fprintf(w, "w = serveRestTest(&h, \"%s\", target, \"{\", header)\n", method)
+		fmt.Fprintln(w, "checkRestTestStatus(t, w, http.StatusBadRequest)")
+		fmt.Fprintln(w, "checkRestTestCall(t, stub, \"\")")
+	}
+	for i, p := range pathParams {
+		if p.TypeName == "string" {
+			continue
+		}
+		invalid, _, _ := getRestTestTarget(rs.Types, path, pathParams, params, i)
+		fmt.Fprintln(w, "\n// path parameter parsing")
+		fmt.Fprintf(w, "w = serveRestTest(&h, \"%s\", %q, %q, header)\n", method, invalid, body)
+		fmt.Fprintln(w, "checkRestTestStatus(t, w, http.StatusBadRequest)")
+		break
+	}
+	if first {
+		writeRestTestRouting(w, rs, path, target)
+	}
+	fmt.Fprint(w, "}\n\n")
+	return nil
+}
+
+// writeRestTestRouting checks the OPTIONS response and that methods the router
+// does not route for the request target of a path are not allowed
+func writeRestTestRouting(w io.Writer, rs routes, path, target string) {
+	allowed := rs.router.allowedMethods(rs, path, target)
+	isAllowed := make(map[string]bool, len(allowed))
+	for _, m := range allowed {
+		isAllowed[m] = true
+	}
+	var notAllowed string
+	for _, m := range model.Methods {
+		if !isAllowed[m] {
+			notAllowed = m
+			break
+		}
+	}
+	allowed = append(allowed, "OPTIONS")
+	fmt.Fprintln(w, "\n// routing")
+	fmt.Fprintln(w, "w = serveRestTest(&h, \"OPTIONS\", target, \"\", nil)")
+	fmt.Fprintln(w, "checkRestTestStatus(t, w, http.StatusNoContent)")
+	allow := strings.Join(allowed, ", ")
+	fmt.Fprintf(w, "if allow := w.Header().Get(\"Allow\"); allow != \"%s\" {\n", allow)
+	fmt.Fprintf(w, "t.Errorf(\"Allow %%s, expected %s\", allow)\n}\n", allow)
+	if notAllowed != "" {
+		fmt.Fprintf(w, "w = serveRestTest(&h, \"%s\", target, \"\", nil)\n", notAllowed)
+		fmt.Fprintln(w, "checkRestTestStatus(t, w, http.StatusMethodNotAllowed)")
+	}
+}
+
+// getRestTestTarget returns the request target with sample values of path and
+// query parameters and the Go literals of the path parameter values. The path
+// parameter with index invalid gets a value that cannot be parsed.
+func getRestTestTarget(types model.Types, path string, pathParams []*model.Param,
+	params []*model.Param, invalid int) (string, []string, error) {
+	literals := make([]string, 0, len(pathParams))
+	for i, p := range pathParams {
+		value, literal, err := getParamSample(types, p)
+		if err != nil {
+			return "", nil, err
+		}
+		if i == invalid {
+			value = "invalid-value"
+		}
+		path = strings.Replace(path, "{"+p.Name+"}", url.PathEscape(value), 1)
+		literals = append(literals, literal)
+	}
+	query := url.Values{}
+	for _, p := range params {
+		if p.In == model.InQuery {
+			value, _, err := getParamSample(types, p)
+			if err != nil {
+				return "", nil, err
+			}
+			query.Add(p.Name, value)
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, literals, nil
+}
+
+// getRestTestHeader returns the Go literal of the request header with sample
+// values of the header and cookie parameters
+func getRestTestHeader(types model.Types, params []*model.Param) (string, error) {
+	header := http.Header{}
+	for _, p := range params {
+		if p.In != model.InHeader && p.In != model.InCookie {
+			continue
+		}
+		value, _, err := getParamSample(types, p)
+		if err != nil {
+			return "", err
+		}
+		switch p.In {
+		case model.InHeader:
+			header.Add(p.Name, value)
+		case model.InCookie:
+			header.Add("Cookie", (&http.Cookie{Name: p.Name, Value: value}).String())
+		}
+	}
+	if len(header) == 0 {
+		return "http.Header(nil)", nil
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	entries := make([]string, len(keys))
+	for i, k := range keys {
+		values := strings.Join(header[k], "; ")
+		entries[i] = fmt.Sprintf("%q: {%q}", k, values)
+	}
+	return "http.Header{" + strings.Join(entries, ", ") + "}", nil
+}
+
+// getParamSample returns a sample request value of a parameter and the Go
+// literal of the parsed value
+func getParamSample(types model.Types, p *model.Param) (string, string, error) {
+	switch p.TypeName {
+	case "string":
+		return "value", `"value"`, nil
+	case "uuid":
+		uuid := "123e4567-e89b-12d3-a456-426614174000"
+		return uuid, strconv.Quote(uuid), nil
+	case "int":
+		return "42", "42", nil
+	case "float", "decimal":
+		return "1.5", "1.5", nil
+	case "bool":
+		return "true", "true", nil
+	case "date":
+		return "2020-01-02", "time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)", nil
+	case "datetime":
+		date := "time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)"
+		return "2020-01-02T03:04:05Z", date, nil
+	}
+	item, err := getEnumSample(types.Get(p.TypeName))
+	if err != nil {
+		return "", "", err
+	}
+	return item, GetEnumConst(p.TypeName, item), nil
+}
+
+// getEnumSample returns the name of the first item of an enum type
+func getEnumSample(t *model.Type) (string, error) {
+	if len(t.Items) == 0 {
+		return "", fmt.Errorf("cannot create sample of enum %s without items", t.Name)
+	}
+	return t.Items[0].Name, nil
+}
+
+// maxSampleDepth limits the nesting of sample values of recursive types
+const maxSampleDepth = 16
+
+// getSampleJSON returns a JSON encoded sample value of a named Sysl type that
+// satisfies the type constraints. Optional fields are omitted, lists, sets
+// and maps are empty.
+func getSampleJSON(types model.Types, typeName string) (string, error) {
+	v, err := getSampleNamed(types, typeName, 0)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func getSampleNamed(types model.Types, name string, depth int) (interface{}, error) {
+	if depth > maxSampleDepth {
+		return nil, fmt.Errorf("cannot create sample of recursive type %s", name)
+	}
+	t := types.Get(name)
+	switch {
+	case strings.HasPrefix(name, "map of"):
+		return map[string]interface{}{}, nil
+	case t == nil:
+		return nil, fmt.Errorf("unknown type %s", name)
+	case t.Kind == model.Enum:
+		return getEnumSample(t)
+	case t.Kind == model.Union:
+		v, err := getSampleNamed(types, t.Variants[0], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		v.(map[string]interface{})[t.Discriminator] = t.Variants[0]
+		return v, nil
+	}
+	result := map[string]interface{}{}
+	for _, f := range t.Fields {
+		if f.Optional {
+			continue
+		}
+		v, err := getSample(types, f.Sysl, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result[f.JSON] = v
+	}
+	return result, nil
+}
+
+func getSample(types model.Types, t *pb.Type, depth int) (interface{}, error) {
+	switch {
+	case t.GetList() != nil:
+		return []interface{}{}, nil
+	case t.GetSet() != nil:
+		return map[string]interface{}{}, nil
+	case t.GetTypeRef() != nil:
+		typeStr, err := GetSimpleType(t)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(typeStr, "map[") {
+			return map[string]interface{}{}, nil
+		}
+		return getSampleNamed(types, typeStr, depth)
+	}
+	switch t.GetPrimitive() {
+	case pb.Type_STRING:
+		return strings.Repeat("x", getSampleLength(t)), nil
+	case pb.Type_INT, pb.Type_FLOAT, pb.Type_DECIMAL:
+		return json.Number(getSampleNumber(t)), nil
+	case pb.Type_BOOL:
+		return true, nil
+	case pb.Type_DATE:
+		return "2020-01-02", nil
+	case pb.Type_DATETIME:
+		return "2020-01-02T03:04:05Z", nil
+	case pb.Type_BYTES:
+		return "eA==", nil
+	case pb.Type_ANY:
+		return "x", nil
+	}
+	return nil, nil
+}
+
+// getSampleLength returns the length of a sample string within the length
+// constraints of its type
+func getSampleLength(t *pb.Type) int {
+	n := int64(1)
+	for _, c := range t.Constraint {
+		if l := c.GetLength(); l != nil {
+			if l.Min > n {
+				n = l.Min
+			}
+			if l.Max > 0 && l.Max < n {
+				n = l.Max
+			}
+		}
+	}
+	return int(n)
+}
+
+// getSampleNumber returns the literal of a sample number within the range
+// constraints of its type
+func getSampleNumber(t *pb.Type) string {
+	n := 1.0
+	for _, c := range t.Constraint {
+		if r := c.GetRange(); r != nil {
+			if min, err := strconv.ParseFloat(getValueLiteral(r.Min), 64); err == nil &&
+				min > n {
+				n = min
+			}
+			if max, err := strconv.ParseFloat(getValueLiteral(r.Max), 64); err == nil &&
+				max < n {
+				n = max
+			}
+		}
+	}
+	return strconv.FormatFloat(n, 'g', -1, 64)
+}
+
+// getRestTestsImports returns the packages imported by the REST handler tests
+func getRestTestsImports(app *pb.Application, epNames []string) []string {
+	imports := []string{
+		"encoding/json", "net/http", "net/http/httptest", "reflect", "strings", "testing",
+	}
+	if HasContext(app) {
+		imports = append([]string{"context"}, imports...)
+	}
+	if hasTimeParams(app, epNames) {
+		imports = append(imports, "time")
+	}
+	return imports
+}
+
+const restTestsPrefix = `// restTestStorer implements the Storer interface, it records the
+// method and arguments of the last call and returns sample results and err.
+type restTestStorer struct {
+	method string
+	args   []interface{}
+	err    error
+}
+
+// restTestError is a StatusError returned by restTestStorer.
+type restTestError struct {
+	status int
+}
+
+func (e *restTestError) Error() string {
+	return http.StatusText(e.status)
+}
+
+func (e *restTestError) Status() int {
+	return e.status
+}
+
+func decodeRestTestSample(sample string, v interface{}) {
+	if err := json.Unmarshal([]byte(sample), v); err != nil {
+		panic(err)
+	}
+}
+
+func serveRestTest(h http.Handler, method, target, body string,
+	header http.Header) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func checkRestTestStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Errorf("status %d, expected %d: %s", w.Code, status, w.Body)
+	}
+}
+
+// checkRestTestCall checks the method called last and its first arguments.
+func checkRestTestCall(t *testing.T, stub *restTestStorer, method string,
+	args ...interface{}) {
+	t.Helper()
+	if stub.method != method {
+		t.Errorf("called %q, expected %q", stub.method, method)
+		return
+	}
+	for i, arg := range args {
+		if !reflect.DeepEqual(stub.args[i], arg) {
+			t.Errorf("argument %d of %s is %#v, expected %#v", i, method,
+				stub.args[i], arg)
+		}
+	}
+}
+`
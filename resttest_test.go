@@ -0,0 +1,194 @@
+package gosysl
+
+import (
+	"bytes"
+	"go/format"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestWriteRestTests(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := newPatchEndpoint()
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Data"}}}
+	get := &pb.Endpoint{Name: "GET /api/{key}", RestParams: ep.RestParams}
+	get.Stmt = []*pb.Statement{ret}
+	app := &pb.Application{
+		Attrs: map[string]*pb.Attribute{"rest_tests": pbtest.NewStringAttr("true")},
+		Endpoints: map[string]*pb.Endpoint{
+			ep.Name: ep, get.Name: get,
+		},
+		Types: map[string]*pb.Type{
+			"Data": pbtest.NewTupleType(map[string]*pb.Type{
+				"Name": pbtest.NewPrimitiveType(1, pb.Type_STRING),
+			}),
+		},
+	}
+	assert.True(HasRestTests(app))
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRestTests(w, app, []string{get.Name, ep.Name}))
+	expected := `var _ Storer = (*restTestStorer)(nil)
+
+func (stub *restTestStorer) GetApiKey(key string) (Data, error) {
+	stub.method, stub.args = "GetApiKey", []interface{}{key}
+	var result Data
+	decodeRestTestSample("{\"Name\":\"x\"}", &result)
+	return result, stub.err
+}
+
+func (stub *restTestStorer) PatchApiKey(key string, dp MergePatch) (Data, error) {
+	stub.method, stub.args = "PatchApiKey", []interface{}{key, dp}
+	var result Data
+	decodeRestTestSample("{\"Name\":\"x\"}", &result)
+	return result, stub.err
+}
+
+// restTestMiddleware implements Middleware without middleware.
+type restTestMiddleware struct{}
+
+func (restTestMiddleware) Root() []func(next http.Handler) http.Handler {
+	return nil
+}
+
+func TestRestGetApiKey(t *testing.T) {
+	stub := &restTestStorer{}
+	h := NewRestHandler(stub, restTestMiddleware{})
+	target, header := "/api/value", http.Header(nil)
+	w := serveRestTest(&h, "GET", target, "", header)
+	checkRestTestStatus(t, w, http.StatusOK)
+	checkRestTestCall(t, stub, "GetApiKey", "value")
+	w = serveRestTest(&h, "HEAD", target, "", header)
+	checkRestTestStatus(t, w, http.StatusOK)
+
+	// errors returned by the Storer
+	stub.err = &restTestError{http.StatusTeapot}
+	w = serveRestTest(&h, "GET", target, "", header)
+	checkRestTestStatus(t, w, http.StatusTeapot)
+	stub.err = nil
+
+	// routing
+	w = serveRestTest(&h, "OPTIONS", target, "", nil)
+	checkRestTestStatus(t, w, http.StatusNoContent)
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, PATCH, OPTIONS" {
+		t.Errorf("Allow %s, expected GET, HEAD, PATCH, OPTIONS", allow)
+	}
+	w = serveRestTest(&h, "POST", target, "", nil)
+	checkRestTestStatus(t, w, http.StatusMethodNotAllowed)
+}
+
+func TestRestPatchApiKey(t *testing.T) {
+	stub := &restTestStorer{}
+	h := NewRestHandler(stub, restTestMiddleware{})
+	target, header := "/api/value", http.Header(nil)
+	w := serveRestTest(&h, "PATCH", target, "{}", header)
+	checkRestTestStatus(t, w, http.StatusOK)
+	checkRestTestCall(t, stub, "PatchApiKey", "value")
+
+	// errors returned by the Storer
+	stub.err = &restTestError{http.StatusTeapot}
+	w = serveRestTest(&h, "PATCH", target, "{}", header)
+	checkRestTestStatus(t, w, http.StatusTeapot)
+	stub.err = nil
+
+	// payload decoding
+	stub.method = ""
+	w = serveRestTest(&h, "PATCH", target, "{", header)
+	checkRestTestStatus(t, w, http.StatusBadRequest)
+	checkRestTestCall(t, stub, "")
+}
+
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(expected, string(actual))
+
+	imports := getRestTestsImports(app, []string{get.Name})
+	expectedImports := []string{
+		"encoding/json", "net/http", "net/http/httptest", "reflect", "strings", "testing",
+	}
+	assert.Equal(expectedImports, imports)
+
+	result, err := GenerateApp(app, "rest")
+	assert.NoError(err)
+	assert.Contains(string(result.RestTest), "func TestRestPatchApiKey(t *testing.T) {")
+
+	app.Attrs = nil
+	assert.False(HasRestTests(app))
+	result, err = GenerateApp(app, "rest")
+	assert.NoError(err)
+	assert.Nil(result.RestTest)
+}
+
+func TestGetSampleJSON(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	name := pbtest.NewPrimitiveType(1, pb.Type_STRING)
+	name.Constraint = []*pb.Type_Constraint{{Length: &pb.Type_Constraint_Length{Min: 3}}}
+	age := pbtest.NewPrimitiveType(2, pb.Type_INT)
+	ageRange := &pb.Type_Constraint_Range{
+		Min: &pb.Value{Value: &pb.Value_I{I: 18}},
+		Max: &pb.Value{Value: &pb.Value_D{D: 150.5}},
+	}
+	age.Constraint = []*pb.Type_Constraint{{Range: ageRange}}
+	nick := pbtest.NewPrimitiveType(3, pb.Type_STRING)
+	nick.Opt = true
+	childList := &pb.Type_List{Type: pbtest.NewRefType(5, "Person")}
+	oneOf := &pb.Type_OneOf{Type: []*pb.Type{pbtest.NewRefType(1, "Person")}}
+	app := &pb.Application{
+		Types: map[string]*pb.Type{
+			"Person": pbtest.NewTupleType(map[string]*pb.Type{
+				"Name":     name,
+				"Age":      age,
+				"Nick":     nick,
+				"Born":     pbtest.NewPrimitiveType(4, pb.Type_DATE),
+				"Children": {Type: &pb.Type_List_{List: childList}},
+			}),
+			"Party": {Type: &pb.Type_OneOf_{OneOf: oneOf}},
+			"Recursive": pbtest.NewTupleType(map[string]*pb.Type{
+				"R": pbtest.NewRefType(1, "Recursive"),
+			}),
+		},
+	}
+	types, err := model.NewTypes(app)
+	assert.NoError(err)
+	person := `{"Age":18,"Born":"2020-01-02","Children":[],"Name":"xxx"}`
+	sample, err := getSampleJSON(types, "Person")
+	assert.NoError(err)
+	assert.Equal(person, sample)
+	sample, err = getSampleJSON(types, "Party")
+	assert.NoError(err)
+	assert.Equal(`{"Age":18,"Born":"2020-01-02","Children":[],"Name":"xxx","type":"Person"}`,
+		sample)
+
+	_, err = getSampleJSON(types, "Recursive")
+	assert.EqualError(err, "cannot create sample of recursive type Recursive")
+	_, err = getSampleJSON(types, "Unknown")
+	assert.EqualError(err, "unknown type Unknown")
+}
+
+func TestEmptyEnumSample(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := &pb.Application{Types: map[string]*pb.Type{
+		"Kind": newEnumType(1, map[string]int64{}),
+		"Pet":  pbtest.NewTupleType(map[string]*pb.Type{"Kind": pbtest.NewRefType(2, "Kind")}),
+	}}
+	types, err := model.NewTypes(app)
+	assert.NoError(err)
+	_, err = getSampleJSON(types, "Pet")
+	assert.EqualError(err, "cannot create sample of enum Kind without items")
+
+	p := &model.Param{In: model.InQuery, Name: "kind", Var: "kind", TypeName: "Kind"}
+	_, _, err = getParamSample(types, p)
+	assert.Error(err)
+	_, _, err = getRestTestTarget(types, "/pets", nil, []*model.Param{p}, -1)
+	assert.Error(err)
+	p.In = model.InHeader
+	_, err = getRestTestHeader(types, []*model.Param{p})
+	assert.Error(err)
+}
@@ -0,0 +1,291 @@
+package gosysl
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// Router backends of the REST handler, set with the app attribute router
+const (
+	RouterChi      = "chi"
+	RouterServeMux = "servemux"
+)
+
+// routerBackend holds the imports and routing checks of the REST handler that
+// depend on the router library. The helpers, the router creation, the routes
+// and the result of handlers are written by the templates <name>.prefix,
+// <name>.router, <name>.routes and <name>.result of the backend, the handlers
+// read path parameters from the request context and are shared by all
+// backends.
+type routerBackend interface {
+	// name returns the name prefixing the templates of the backend
+	name() string
+	// imports returns the packages imported in addition to restImports
+	imports() []string
+	// checkRoutes returns an error if the router cannot serve the routes
+	checkRoutes(rs routes) error
+	// allowedMethods returns the methods routed for the request target of a
+	// route path in the order of the Allow header, without OPTIONS
+	allowedMethods(rs routes, path, target string) []string
+}
+
+// routerBackends holds the router backends by name
+var routerBackends = map[string]routerBackend{
+	RouterChi:      chiBackend{},
+	RouterServeMux: serveMuxBackend{},
+}
+
+// GetRouter returns the router backend of the REST handler, set with the app
+// attribute router to "chi" (default) or "servemux" for net/http.ServeMux
+func GetRouter(app *pb.Application) (string, error) {
+	attr, ok := app.Attrs["router"]
+	if !ok {
+		return RouterChi, nil
+	}
+	if _, ok := routerBackends[attr.GetS()]; !ok {
+		return "", fmt.Errorf("invalid router '%s', expect %s or %s", attr.GetS(),
+			RouterChi, RouterServeMux)
+	}
+	return attr.GetS(), nil
+}
+
+func getRouterBackend(app *pb.Application) (routerBackend, error) {
+	name, err := GetRouter(app)
+	if err != nil {
+		return nil, err
+	}
+	return routerBackends[name], nil
+}
+
+// backendTemplates holds the templates of the REST handler written by the
+// router backend
+var backendTemplates = []string{"prefix", "router", "routes", "result"}
+
+// getBackendTemplates returns a copy of the templates with the prefix, router,
+// routes and result templates of a router backend defined
+func getBackendTemplates(tmpl *template.Template,
+	backend routerBackend) (*template.Template, error) {
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range backendTemplates {
+		t := tmpl.Lookup(backend.name() + "." + name)
+		if t == nil {
+			return nil, fmt.Errorf("template %s.%s not defined", backend.name(), name)
+		}
+		if _, err := tmpl.AddParseTree(name, t.Tree); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+// getRestImports returns the packages imported by the REST handler of a router
+// backend, without reflect if MergePatch is defined in a separate types package
+func getRestImports(backend routerBackend, separate bool) []string {
+	imports := append(append([]string{}, restImports...), backend.imports()...)
+	if separate {
+		return removeImport(imports, "reflect")
+	}
+	return imports
+}
+
+// allowMethods holds the order of methods in Allow headers
+var allowMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// getHandlerMethod returns the method of the handler serving a method, HEAD is
+// served by the GET handler
+func getHandlerMethod(method string) string {
+	if method == "HEAD" {
+		return "GET"
+	}
+	return method
+}
+
+// chiBackend routes with github.com/go-chi/chi and writes JSON responses with
+// github.com/go-chi/render
+type chiBackend struct{}
+
+func (chiBackend) name() string {
+	return RouterChi
+}
+
+func (chiBackend) imports() []string {
+	return []string{"", "github.com/go-chi/chi", "github.com/go-chi/render"}
+}
+
+func (chiBackend) checkRoutes(rs routes) error {
+	return nil
+}
+
+// allowedMethods returns the methods of the route, chi prefers static path
+// segments over parameters and routes a target to a single path
+func (chiBackend) allowedMethods(rs routes, path, target string) []string {
+	p := rs.Path(path)
+	allowed := make([]string, 0, len(p.Operations)+1)
+	for _, m := range allowMethods {
+		if p.Operation(getHandlerMethod(m)) != nil {
+			allowed = append(allowed, m)
+		}
+	}
+	return allowed
+}
+
+// serveMuxBackend routes with the method and wildcard patterns of
+// net/http.ServeMux (Go 1.22) and has no dependencies. GET patterns serve HEAD
+// as well, OPTIONS requests are answered for every routed path before the
+// path middleware.
+type serveMuxBackend struct{}
+
+func (serveMuxBackend) name() string {
+	return RouterServeMux
+}
+
+func (serveMuxBackend) imports() []string {
+	return []string{"strings"}
+}
+
+// checkRoutes returns an error for invalid and conflicting patterns, which
+// ServeMux panics on
+func (serveMuxBackend) checkRoutes(rs routes) error {
+	patterns := getServeMuxPatterns(rs)
+	for i, p := range patterns {
+		if err := p.check(); err != nil {
+			return fmt.Errorf("routes not supported by router servemux: %v", err)
+		}
+		for _, q := range patterns[:i] {
+			if p.conflicts(q) {
+				return fmt.Errorf("routes not supported by router servemux: "+
+					"pattern %q conflicts with pattern %q", p, q)
+			}
+		}
+	}
+	return nil
+}
+
+// allowedMethods matches the ServeMux patterns, the target may match patterns
+// of other paths for some methods
+func (serveMuxBackend) allowedMethods(rs routes, path, target string) []string {
+	segments := getPathSegments(strings.SplitN(target, "?", 2)[0])
+	for i, s := range segments {
+		if u, err := url.PathUnescape(s); err == nil {
+			segments[i] = u
+		}
+	}
+	patterns := getServeMuxPatterns(rs)
+	var allowed []string
+	for _, m := range allowMethods {
+		for _, p := range patterns {
+			if p.method == getHandlerMethod(m) && p.matches(segments) {
+				allowed = append(allowed, m)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// serveMuxPattern is the pattern of an operation, the segments of its path
+// with an empty last segment for a trailing slash
+type serveMuxPattern struct {
+	method   string
+	path     string
+	segments []string
+}
+
+func getServeMuxPatterns(rs routes) []serveMuxPattern {
+	var patterns []serveMuxPattern
+	for _, path := range rs.Paths {
+		for _, op := range path.Operations {
+			patterns = append(patterns,
+				serveMuxPattern{op.Method, path.Path, getPathSegments(path.Path)})
+		}
+	}
+	return patterns
+}
+
+// String returns the pattern registered with ServeMux
+func (p serveMuxPattern) String() string {
+	return getServeMuxPattern(p.method, p.path)
+}
+
+// wildcardRe matches the path segments ServeMux accepts as wildcard
+var wildcardRe = regexp.MustCompile(`^\{[\pL_][\pL\p{Nd}_]*\}$`)
+
+// check returns an error for invalid and duplicate wildcards
+func (p serveMuxPattern) check() error {
+	names := map[string]bool{}
+	for _, s := range p.segments {
+		if !strings.ContainsAny(s, "{}") {
+			continue
+		}
+		if !wildcardRe.MatchString(s) {
+			return fmt.Errorf("pattern %q has invalid wildcard %s", p, s)
+		}
+		if names[s] {
+			return fmt.Errorf("pattern %q has duplicate wildcard %s", p, s)
+		}
+		names[s] = true
+	}
+	return nil
+}
+
+// conflicts reports whether two patterns match the same requests without one
+// being more specific, that is matching a subset of the requests of the other
+func (p serveMuxPattern) conflicts(q serveMuxPattern) bool {
+	if p.method != q.method || len(p.segments) != len(q.segments) {
+		return false
+	}
+	var pMore, qMore bool
+	for i, ps := range p.segments {
+		qs := q.segments[i]
+		switch pw, qw := isWildcard(ps), isWildcard(qs); {
+		case !pw && !qw && ps != qs, pw && qs == "", qw && ps == "":
+			return false
+		case pw && !qw:
+			qMore = true
+		case qw && !pw:
+			pMore = true
+		}
+	}
+	return pMore == qMore
+}
+
+// matches reports whether the pattern matches the segments of a request path,
+// wildcards match non-empty segments
+func (p serveMuxPattern) matches(segments []string) bool {
+	if len(p.segments) != len(segments) {
+		return false
+	}
+	for i, s := range p.segments {
+		if isWildcard(s) && segments[i] == "" || !isWildcard(s) && s != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// getPathSegments returns the segments of a path, a trailing slash adds an
+// empty last segment
+func getPathSegments(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
+
+func isWildcard(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// getServeMuxPattern returns the ServeMux pattern of a method and path, paths
+// with trailing slash match exactly as with chi
+func getServeMuxPattern(method, path string) string {
+	if strings.HasSuffix(path, "/") {
+		path += "{$}"
+	}
+	return method + " " + path
+}
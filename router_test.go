@@ -0,0 +1,163 @@
+package gosysl
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestGetRouter(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := &pb.Application{}
+	router, err := GetRouter(app)
+	assert.NoError(err)
+	assert.Equal(RouterChi, router)
+
+	app.Attrs = map[string]*pb.Attribute{"router": pbtest.NewStringAttr("servemux")}
+	router, err = GetRouter(app)
+	assert.NoError(err)
+	assert.Equal(RouterServeMux, router)
+
+	app.Attrs["router"] = pbtest.NewStringAttr("gorilla")
+	_, err = GetRouter(app)
+	assert.EqualError(err, "invalid router 'gorilla', expect chi or servemux")
+	_, err = GenerateApp(app, "api")
+	assert.EqualError(err, "invalid router 'gorilla', expect chi or servemux")
+}
+
+func TestWriteServeMuxRoutes(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ep := newPatchEndpoint()
+	get := &pb.Endpoint{Name: "GET /api/{key}", RestParams: ep.RestParams}
+	get.Stmt = ep.Stmt
+	noRet := &pb.Statement{Stmt: &pb.Statement_Action{Action: &pb.Action{Action: "return"}}}
+	del := &pb.Endpoint{Name: "DELETE /api/", Stmt: []*pb.Statement{noRet}}
+	app := &pb.Application{
+		Attrs:     map[string]*pb.Attribute{"router": pbtest.NewStringAttr("servemux")},
+		Endpoints: map[string]*pb.Endpoint{ep.Name: ep, get.Name: get, del.Name: del},
+	}
+	epNames := []string{get.Name, ep.Name, del.Name}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, epNames))
+	expected := `	mux := http.NewServeMux()
+	root := chain(serveOptions(mux), m.Root()...)
+	rh := RestHandler{storer: s, router: root, encodeError: EncodeProblem}
+	for _, opt := range opts {
+		opt(&rh)
+	}
+
+	var mw []func(http.Handler) http.Handler
+	mw = []func(http.Handler) http.Handler{makeContextSaver(KeyKey, "key")}
+	mux.Handle("GET /api/{key}", chain(http.HandlerFunc(rh.handleGetApiKey), mw...))
+	mux.Handle("PATCH /api/{key}", chain(http.HandlerFunc(rh.handlePatchApiKey), mw...))
+	mux.Handle("DELETE /api/{$}", http.HandlerFunc(rh.handleDeleteApi))
+	return rh
+}
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), expected)
+	assert.Contains(string(actual), `	writeJSON(w, http.StatusOK, result)
+}
+`)
+	assert.Contains(string(actual), `	w.WriteHeader(http.StatusNoContent)
+}
+`)
+	assert.NotContains(string(actual), "render.")
+
+	rs, err := getRoutes(app, epNames)
+	assert.NoError(err)
+	allowed := rs.router.allowedMethods(rs, "/api/{key}", "/api/x")
+	assert.Equal([]string{"GET", "HEAD", "PATCH"}, allowed)
+
+	result, err := GenerateApp(app, "api")
+	assert.NoError(err)
+	assert.NotContains(string(result.Rest), "github.com/go-chi")
+	assert.Contains(string(result.Rest), "r.PathValue(urlParam)")
+}
+
+func TestServeMuxConflicts(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ret := []*pb.Statement{{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "string"}}}}
+	admin := &pb.Endpoint{Name: "GET /api/admin/{key}", Stmt: ret}
+	name := &pb.Endpoint{Name: "GET /api/{key}/name", Stmt: ret}
+	del := &pb.Endpoint{Name: "DELETE /api/{id}/{startTime}", Stmt: ret}
+	app := &pb.Application{
+		Endpoints: map[string]*pb.Endpoint{
+			admin.Name: admin, name.Name: name, del.Name: del,
+		},
+	}
+	epNames := []string{admin.Name, name.Name}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteRest(w, app, epNames))
+
+	app.Attrs = map[string]*pb.Attribute{"router": pbtest.NewStringAttr("servemux")}
+	err := WriteRest(w, app, epNames)
+	assert.EqualError(err, `routes not supported by router servemux: pattern `+
+		`"GET /api/{key}/name" conflicts with pattern "GET /api/admin/{key}"`)
+
+	// the target of a path is routed to other paths for some methods
+	epNames = []string{name.Name, del.Name}
+	rs, err := getRoutes(app, epNames)
+	assert.NoError(err)
+	assert.Equal([]string{"GET", "HEAD", "DELETE"},
+		rs.router.allowedMethods(rs, "/api/{key}/name", "/api/x/name"))
+}
+
+var serveMuxConflictTests = []struct {
+	p, q     string
+	conflict bool
+}{
+	{"GET /a/{x}", "GET /a/{y}", true},
+	{"GET /a/{x}", "PUT /a/{x}", false},
+	{"GET /a/b", "GET /a/{x}", false},
+	{"GET /a/{x}/b", "GET /a/c/{y}", true},
+	{"GET /a/{x}/b", "GET /a/c/b", false},
+	{"GET /a/b", "GET /a/c", false},
+	{"GET /a/", "GET /a/{x}", false},
+	{"GET /a/", "GET /a/", true},
+	{"GET /a", "GET /a/", false},
+	{"GET /{x}/{y}", "GET /a/{y}", false},
+}
+
+func TestServeMuxPatternConflicts(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	pattern := func(s string) serveMuxPattern {
+		parts := strings.SplitN(s, " ", 2)
+		return serveMuxPattern{parts[0], parts[1], getPathSegments(parts[1])}
+	}
+	for _, test := range serveMuxConflictTests {
+		p, q := pattern(test.p), pattern(test.q)
+		assert.Equal(test.conflict, p.conflicts(q), "%s %s", test.p, test.q)
+		assert.Equal(test.conflict, q.conflicts(p), "%s %s", test.q, test.p)
+	}
+	assert.Equal("GET /a/{$}", pattern("GET /a/").String())
+}
+
+func TestServeMuxInvalidWildcards(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	ret := []*pb.Statement{{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "string"}}}}
+	ep := &pb.Endpoint{Name: "GET /api/{id}/x{y}", Stmt: ret}
+	app := &pb.Application{
+		Attrs:     map[string]*pb.Attribute{"router": pbtest.NewStringAttr("servemux")},
+		Endpoints: map[string]*pb.Endpoint{ep.Name: ep},
+	}
+	err := WriteRest(&bytes.Buffer{}, app, []string{ep.Name})
+	assert.EqualError(err, `routes not supported by router servemux: pattern `+
+		`"GET /api/{id}/x{y}" has invalid wildcard x{y}`)
+
+	p := serveMuxPattern{"GET", "/{a}/{a}", getPathSegments("/{a}/{a}")}
+	assert.EqualError(p.check(), `pattern "GET /{a}/{a}" has duplicate wildcard {a}`)
+	p = serveMuxPattern{"GET", "/{a_1}/{b}/", getPathSegments("/{a_1}/{b}/")}
+	assert.NoError(p.check())
+}
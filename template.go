@@ -0,0 +1,53 @@
+package gosysl
+
+import (
+	"embed"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// builtinTemplateFS holds the built-in templates of the REST handler, the
+// Middleware and Storer interfaces and the types
+//
+//go:embed templates/*.tmpl
+var builtinTemplateFS embed.FS
+
+// templateFuncs are the functions available in templates
+var templateFuncs = template.FuncMap{
+	"join":            strings.Join,
+	"lower":           strings.ToLower,
+	"title":           strings.Title,
+	"statusExpr":      getStatusExpr,
+	"serveMuxPattern": getServeMuxPattern,
+}
+
+var builtinTemplates = template.Must(template.New("").Funcs(templateFuncs).
+	ParseFS(builtinTemplateFS, "templates/*.tmpl"))
+
+// GetTemplateDir returns the directory of templates overriding the built-in
+// templates, set with the app attribute template_dir
+func GetTemplateDir(app *pb.Application) string {
+	return app.Attrs["template_dir"].GetS()
+}
+
+// getTemplates returns the templates of an application, the built-in
+// templates with the templates defined in the *.tmpl files of the template
+// directory replacing those of the same name
+func getTemplates(app *pb.Application) (*template.Template, error) {
+	dir := GetTemplateDir(app)
+	if dir == "" {
+		return builtinTemplates, nil
+	}
+	tmpl, err := builtinTemplates.Clone()
+	if err != nil {
+		return nil, err
+	}
+	if tmpl, err = tmpl.ParseGlob(filepath.Join(dir, "*.tmpl")); err != nil {
+		return nil, fmt.Errorf("invalid template_dir %s: %v", dir, err)
+	}
+	return tmpl, nil
+}
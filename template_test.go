@@ -0,0 +1,109 @@
+package gosysl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+const overrideTemplates = `{{define "field" -}}
+{{.Name}} {{.Type}} ` + "`json:\"{{.JSON}}\" yaml:\"{{.JSON}}\"`" + `
+{{end}}
+
+{{define "method" -}}
+// {{.Name}} is called by handle{{.Name}}.
+{{.Name}}({{.Params}}) {{.Results}}
+{{end}}
+
+{{define "chi.prefix"}}
+// makeContextSaver is overridden.
+func makeContextSaver(k ContextKeyType, urlParam string) func(http.Handler) http.Handler {
+	return nil
+}
+{{end}}
+
+{{define "middleware" -}}
+// Middleware is overridden.
+type Middleware interface {
+Root() []func(next http.Handler) http.Handler
+}
+{{end}}
+`
+
+func newTemplateApp(dir string) *pb.Application {
+	ep := newPatchEndpoint()
+	data := pbtest.NewTupleType(map[string]*pb.Type{
+		"Name": pbtest.NewPrimitiveType(1, pb.Type_STRING),
+	})
+	return &pb.Application{
+		Endpoints: map[string]*pb.Endpoint{ep.Name: ep},
+		Types:     map[string]*pb.Type{"Data": pbtest.NewLineType(1, data)},
+		Attrs:     map[string]*pb.Attribute{"template_dir": pbtest.NewStringAttr(dir)},
+	}
+}
+
+func TestTemplateDir(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir, err := ioutil.TempDir("", "templates")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "override.tmpl")
+	assert.NoError(ioutil.WriteFile(file, []byte(overrideTemplates), 0644))
+
+	app := newTemplateApp(dir)
+	assert.Equal(dir, GetTemplateDir(app))
+	w := &bytes.Buffer{}
+	assert.NoError(WriteTypes(w, app))
+	assert.Contains(w.String(), "type Data struct{\n"+
+		"Name string `json:\"Name\" yaml:\"Name\"`\n}\n")
+
+	w.Reset()
+	assert.NoError(WriteInterface(w, app, []string{"PATCH /api/{key}"}))
+	assert.Contains(w.String(), "// PatchApiKey is called by handlePatchApiKey.\n"+
+		"PatchApiKey(key string, dp MergePatch) (Data, error)\n")
+
+	// templates not overridden are the built-in ones
+	w.Reset()
+	assert.NoError(WriteRest(w, app, []string{"PATCH /api/{key}"}))
+	assert.Contains(w.String(), "func (rh *RestHandler) handlePatchApiKey(")
+
+	// the helpers of the REST handler and the middleware are templates as well
+	result, err := GenerateApp(app, "api")
+	assert.NoError(err)
+	assert.Contains(string(result.Rest), "// makeContextSaver is overridden.\n")
+	assert.Contains(string(result.Rest), "type MergePatch []byte\n")
+	assert.Contains(string(result.Middleware), "// Middleware is overridden.\n")
+
+	// the built-in templates are not changed by the override
+	app.Attrs = nil
+	w.Reset()
+	assert.NoError(WriteTypes(w, app))
+	assert.Contains(w.String(), "Name string `json:\"Name\"`\n")
+}
+
+func TestTemplateDirErrors(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	dir, err := ioutil.TempDir("", "templates")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// no templates in dir
+	_, err = GenerateApp(newTemplateApp(dir), "api")
+	pattern := filepath.Join(dir, "*.tmpl")
+	assert.EqualError(err, "invalid template_dir "+dir+
+		": template: pattern matches no files: `"+pattern+"`")
+
+	file := filepath.Join(dir, "bad.tmpl")
+	assert.NoError(ioutil.WriteFile(file, []byte(`{{define "field"}}{{.Name}`), 0644))
+	_, err = GenerateApp(newTemplateApp(dir), "api")
+	assert.Error(err)
+	assert.Contains(err.Error(), "invalid template_dir "+dir+": template: bad.tmpl:1:")
+}
@@ -3,208 +3,376 @@ package gosysl
 import (
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
-	"unicode"
+	"text/template"
 
+	"github.com/anz-bank/gosysl/model"
 	"github.com/anz-bank/gosysl/pb"
 )
 
 // GetPrimitiveType return Golang type string for Sysl primitive data type
 func GetPrimitiveType(tp *pb.Type_Primitive) (string, error) {
-	switch *tp {
-	case pb.Type_BOOL:
-		return "bool", nil
-	case pb.Type_ANY:
-		return "interface{}", nil
-	case pb.Type_INT:
-		return "int", nil
-	case pb.Type_STRING:
-		return "string", nil
-	case pb.Type_EMPTY:
-		return "nil", nil
-	case pb.Type_FLOAT, pb.Type_DECIMAL:
-		return "float64", nil
-	case pb.Type_BYTES:
-		return "[]byte", nil
-	case pb.Type_DATE, pb.Type_DATETIME:
-		return "time.Time", nil
-	}
-	// Type_XML, Type_UUID
-	return "", fmt.Errorf("unsupported type primitive %s", tp.String())
+	return model.GetPrimitiveType(tp)
 }
 
 // GetSimpleType returns Golang type string for non-composite types (no lists and sets)
 func GetSimpleType(t *pb.Type) (string, error) {
-	if pType := t.GetPrimitive(); pType != pb.Type_NO_Primitive {
-		return GetPrimitiveType(&pType)
-	}
-	if t.GetTypeRef() != nil {
-		path := t.GetTypeRef().GetRef().GetPath()
-		if len(path) != 1 {
-			return "", fmt.Errorf("cannot handle type reference with more than one path")
-		}
-		str := path[0]
-		if !strings.HasPrefix(str, "map of") {
-			return str, nil
-		}
-		str = strings.TrimPrefix(str, "map of")
-		str = strings.Trim(str, " ")
-		m := strings.Split(str, ":")
-		if len(m) != 2 {
-			shouldStr := `should be map of KeyType:ValueType`
-			return "", fmt.Errorf("bad map definition '%s' (%s)", str, shouldStr)
-		}
-		return fmt.Sprintf("map[%s]%s", m[0], m[1]), nil
-	}
-	return "", fmt.Errorf("type %v is neither primitive nor reference", t)
-
+	return model.GetSimpleType(t)
 }
 
 // GetTypeLine returns the line for a given Sysl type from its SourceContext
 func GetTypeLine(t *pb.Type) (int32, error) {
-	if t.GetPrimitive() != pb.Type_NO_Primitive || t.GetTypeRef() != nil {
-		return t.SourceContext.Start.Line, nil
-	}
-	if t.GetList() != nil {
-		return t.GetList().GetType().SourceContext.Start.Line, nil
-	}
-	if t.GetSet() != nil {
-		return t.GetSet().SourceContext.Start.Line, nil
-	}
-	if t.GetTuple() != nil {
-		for _, t2 := range t.GetTuple().GetAttrDefs() {
-			return GetTypeLine(t2)
-		}
-	}
-	return 0, fmt.Errorf("unknown type %v for getting line", t)
+	return model.GetTypeLine(t)
 }
 
 //NamesSortedBySourceContext sorts the keys of the input types according to occurrence
 // in Sysl definition file, derived from SourceContext
 func NamesSortedBySourceContext(types map[string]*pb.Type) ([]string, error) {
-	lineNames := make([]LineName, len(types))
-	i := 0
-	for name, t := range types {
-		line, err := GetTypeLine(t)
-		if err != nil {
-			return nil, err
-		}
-		lineNames[i] = LineName{name, line}
-		i++
-	}
-	return SortLineNames(lineNames), nil
+	return model.NamesSortedBySourceContext(types)
 }
 
 // SplitUppercase splits into fields at all upper case letters and converts
 // fields to lower case
 func SplitUppercase(str string) []string {
-	result := make([]string, 0, 8)
-	idx := make([]int, 0, 8)
-	for pos, c := range str {
-		if unicode.IsUpper(c) || pos == 0 {
-			idx = append(idx, pos)
-		}
-	}
-	idx = append(idx, len(str))
-	for i := 0; i < len(idx)-1; i++ {
-		result = append(result, strings.ToLower(str[idx[i]:idx[i+1]]))
-	}
-	return result
+	return model.SplitUppercase(str)
 }
 
 // GetJSONProperty extracts JSON property name from attribute and defaults to type name
 func GetJSONProperty(name string, t *pb.Type, sep string) string {
-	if attrOverride, ok := t.Attrs["json"]; ok {
-		return attrOverride.GetS()
-	}
-	if sep == "" {
-		return name
-	}
-	return strings.Join(SplitUppercase(name), sep)
+	return model.GetJSONProperty(name, t, sep)
 }
 
 // GetType creates golang type for given sysl type
 func GetType(t *pb.Type) (string, *pb.Type, error) {
-	var err error
-	var typeStr string
-	if t.GetPrimitive() != pb.Type_NO_Primitive || t.GetTypeRef() != nil {
-		// Primitive type, reference or map
-		if typeStr, err = GetSimpleType(t); err == nil {
-			return typeStr, t, nil
-		}
-	} else if t.GetList() != nil {
-		// List
-		t = t.GetList().GetType()
-		if typeStr, err = GetSimpleType(t); err == nil {
-			return fmt.Sprintf("[]%s", typeStr), t, nil
-		}
-	} else if t.GetSet() != nil {
-		// Set
-		t = t.GetSet()
-		if typeStr, err = GetSimpleType(t); err == nil {
-			return fmt.Sprintf("map[%s]interface{}", typeStr), t, nil
-		}
+	return model.GetType(t)
+}
+
+// Strategies for generating optional fields, selected with the optional_fields
+// application attribute
+const (
+	// OptionalPointer generates pointer fields omitted from JSON if nil
+	OptionalPointer = "pointer"
+	// OptionalOmitEmpty generates value fields omitted from JSON if zero
+	OptionalOmitEmpty = "omitempty"
+	// OptionalWrapper generates Optional<Type> fields holding value and presence
+	OptionalWrapper = "wrapper"
+)
+
+// GetOptionalStrategy returns the strategy for optional fields of an
+// application, OptionalPointer by default
+func GetOptionalStrategy(app *pb.Application) (string, error) {
+	attr, ok := app.Attrs["optional_fields"]
+	if !ok {
+		return OptionalPointer, nil
 	}
-	if err != nil {
-		return "", nil, err
+	switch s := attr.GetS(); s {
+	case OptionalPointer, OptionalOmitEmpty, OptionalWrapper:
+		return s, nil
 	}
-	return "", nil, fmt.Errorf("unknown type %s", t.String())
+	return "", fmt.Errorf("invalid optional_fields strategy '%s'", attr.GetS())
+}
+
+// isNilable reports whether a missing value of Go type typeStr is nil
+func isNilable(typeStr string) bool {
+	return typeStr == "interface{}" ||
+		strings.HasPrefix(typeStr, "[]") ||
+		strings.HasPrefix(typeStr, "map[")
+}
+
+// GetOptionalType returns the Go type and the JSON tag options of an optional
+// field of Go type typeStr for given strategy. Struct and union types looked up
+// in types are pointers with every strategy, which allows recursive types.
+func GetOptionalType(typeStr, strategy string, types model.Types) (string, string) {
+	switch {
+	case isValidated(types, typeStr):
+		return "*" + typeStr, ",omitempty"
+	case isNilable(typeStr) || strategy == OptionalOmitEmpty:
+		return typeStr, ",omitempty"
+	case strategy == OptionalWrapper:
+		return GetOptionalWrapper(typeStr), ""
+	}
+	return "*" + typeStr, ",omitempty"
+}
+
+// GetOptionalWrapper returns the name of the wrapper type holding an optional
+// value of Go type typeStr
+func GetOptionalWrapper(typeStr string) string {
+	typeStr = strings.TrimPrefix(typeStr, "time.")
+	return "Optional" + strings.Title(typeStr)
+}
+
+// structData is the template data of a struct type
+type structData struct {
+	Name   string
+	Doc    string
+	Fields []fieldData
 }
 
-// WriteStructField creates a single line inside a struct definition
+// fieldData is the template data of a struct field with its JSON property
+// name and options
+type fieldData struct {
+	Name string
+	Type string
+	JSON string
+}
+
+func getFieldData(f *model.Field, types model.Types, optional string) fieldData {
+	data := fieldData{f.Name, f.GoType, f.JSON}
+	if f.Optional {
+		var tagOpts string
+		data.Type, tagOpts = GetOptionalType(f.GoType, optional, types)
+		data.JSON += tagOpts
+	}
+	return data
+}
+
+// WriteStructField creates a single line inside a struct definition, optional
+// fields are pointers
 func WriteStructField(w io.Writer, fName string, fType *pb.Type, sep string) error {
-	fTypeStr, subType, err := GetType(fType)
+	return WriteStructFieldOptional(w, fName, fType, sep, OptionalPointer)
+}
+
+// WriteStructFieldOptional creates a single line inside a struct definition,
+// optional fields are generated with given strategy. Optional references to
+// struct types are only pointers with OptionalPointer as the referenced types
+// are unknown.
+func WriteStructFieldOptional(w io.Writer, fName string, fType *pb.Type, sep,
+	optional string) error {
+	field, err := model.NewField(fName, fType, sep)
 	if err != nil {
 		return err
 	}
-	jsonProp := GetJSONProperty(fName, subType, sep)
-	fmt.Fprintf(w, "%s %s `json:\"%s\"`\n", fName, fTypeStr, jsonProp)
-	return nil
+	data := getFieldData(field, nil, optional)
+	return builtinTemplates.ExecuteTemplate(w, "field", data)
 }
 
-// WriteStruct creates a Golang `struct` type definition from a Sysl Tuple type definition
+// WriteStruct creates a Golang `struct` type definition from a Sysl Tuple type
+// definition, optional fields are pointers
 func WriteStruct(w io.Writer, name string, t *pb.Type, jsonSep string) error {
+	return WriteStructOptional(w, name, t, jsonSep, OptionalPointer)
+}
+
+// WriteStructOptional creates a Golang `struct` type definition from a Sysl
+// Tuple type definition, optional fields are generated with given strategy
+func WriteStructOptional(w io.Writer, name string, t *pb.Type, jsonSep,
+	optional string) error {
 	if t.GetTuple() == nil {
 		return fmt.Errorf("top level type has to be Tuple")
 	}
-	if attr, ok := t.Attrs["doc"]; ok {
-		fmt.Fprintf(w, "// %s\n", attr.GetS())
-	}
-	fmt.Fprintf(w, "type %s struct{\n", name)
-	attrDefs := t.GetTuple().GetAttrDefs()
-
-	names, err := NamesSortedBySourceContext(attrDefs)
+	fields, err := model.GetFields(t, jsonSep)
 	if err != nil {
 		return err
 	}
+	typ := &model.Type{Name: name, Kind: model.Struct, Doc: t.Attrs["doc"].GetS(),
+		Fields: fields, Sysl: t}
+	return writeStruct(w, builtinTemplates, typ, model.Types{typ}, optional)
+}
 
-	for _, fieldName := range names {
-		if err = WriteStructField(w, fieldName, attrDefs[fieldName], jsonSep); err != nil {
-			return err
-		}
+func writeStruct(w io.Writer, tmpl *template.Template, t *model.Type,
+	types model.Types, optional string) error {
+	data := structData{Name: t.Name, Doc: t.Doc}
+	for _, f := range t.Fields {
+		data.Fields = append(data.Fields, getFieldData(f, types, optional))
 	}
-	fmt.Fprintln(w, "}")
-	return nil
+	return tmpl.ExecuteTemplate(w, "struct", data)
 }
 
 // WriteTypes creates all types definition in SourceContext order for given Sysl
 // type definition
 func WriteTypes(w io.Writer, app *pb.Application) error {
-	types := app.GetTypes()
-	names, err := NamesSortedBySourceContext(types)
+	types, err := model.NewTypes(app)
 	if err != nil {
 		return err
 	}
-	var jsonSep string
-	if attr, ok := app.Attrs["json_property_separator"]; ok {
-		jsonSep = attr.GetS()
+	optional, err := GetOptionalStrategy(app)
+	if err != nil {
+		return err
+	}
+	tmpl, err := getTemplates(app)
+	if err != nil {
+		return err
 	}
 
-	for _, name := range names {
-		t := types[name]
-		if err := WriteStruct(w, name, t, jsonSep); err != nil {
+	hasUnion := false
+	for _, t := range types {
+		switch t.Kind {
+		case model.Enum:
+			err = writeEnum(w, tmpl, t)
+		case model.Union:
+			hasUnion = true
+			err = writeUnion(w, tmpl, t)
+		default:
+			err = writeStruct(w, tmpl, t, types, optional)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if hasUnion {
+		if err := tmpl.ExecuteTemplate(w, "unionHelpers", nil); err != nil {
 			return err
 		}
 	}
+	if optional == OptionalWrapper {
+		for _, typeStr := range getOptionalWrapped(types) {
+			data := optionalWrapperData{GetOptionalWrapper(typeStr), typeStr}
+			if err := tmpl.ExecuteTemplate(w, "optionalWrapper", data); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+// getOptionalWrapped returns the Go types of optional fields that need a
+// wrapper type in order of first occurrence
+func getOptionalWrapped(types model.Types) []string {
+	result := []string{}
+	set := map[string]struct{}{}
+	for _, t := range types {
+		for _, f := range t.Fields {
+			if !f.Optional || isNilable(f.GoType) || isValidated(types, f.GoType) {
+				continue
+			}
+			if _, ok := set[f.GoType]; !ok {
+				set[f.GoType] = struct{}{}
+				result = append(result, f.GoType)
+			}
+		}
+	}
+	return result
+}
+
+// optionalWrapperData is the template data of the wrapper type Name of
+// optional values of Go type Type
+type optionalWrapperData struct {
+	Name string
+	Type string
+}
+
+// GetTypesImports returns the packages imported by the type definitions of an
+// application
+func GetTypesImports(app *pb.Application) []string {
+	imports := make([]string, 0, 3)
+	hasJSON, hasFmt, hasTime := false, false, false
+	optional, _ := GetOptionalStrategy(app)
+	types, _ := model.NewTypes(app)
+	for _, t := range app.GetTypes() {
+		if t.GetEnum() != nil || t.GetOneOf() != nil {
+			hasJSON, hasFmt = true, true
+		}
+		for _, field := range t.GetTuple().GetAttrDefs() {
+			typeStr, _, err := GetType(field)
+			if err != nil {
+				continue
+			}
+			if typeStr == "time.Time" {
+				hasTime = true
+			}
+			wrapped := !isNilable(typeStr) && !isValidated(types, typeStr)
+			if field.Opt && optional == OptionalWrapper && wrapped {
+				hasJSON = true
+			}
+		}
+	}
+	if hasJSON {
+		imports = append(imports, "encoding/json")
+	}
+	if hasFmt {
+		imports = append(imports, "fmt")
+	}
+	if hasTime {
+		imports = append(imports, "time")
+	}
+	return imports
+}
+
+var reEnumItemSeparate = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// GetEnumConst creates the Go constant name for an enum item
+func GetEnumConst(enumName, item string) string {
+	fields := reEnumItemSeparate.Split(item, -1)
+	for i, field := range fields {
+		fields[i] = strings.Title(strings.ToLower(field))
+	}
+	return enumName + strings.Join(fields, "")
+}
+
+// enumData is the template data of an enum type, NamesVar is the variable
+// mapping values to item names
+type enumData struct {
+	Name     string
+	Doc      string
+	NamesVar string
+	Items    []enumItemData
+}
+
+// enumItemData is the template data of an enum item
+type enumItemData struct {
+	Const string
+	Name  string
+	Value int64
+}
+
+// WriteEnum creates a Golang type with constants, String, Parse and JSON
+// marshalling methods from a Sysl Enum type definition
+func WriteEnum(w io.Writer, name string, t *pb.Type) error {
+	typ := &model.Type{Name: name, Kind: model.Enum, Doc: t.Attrs["doc"].GetS(),
+		Items: model.GetEnumItems(t), Sysl: t}
+	return writeEnum(w, builtinTemplates, typ)
+}
+
+func writeEnum(w io.Writer, tmpl *template.Template, t *model.Type) error {
+	data := enumData{
+		Name:     t.Name,
+		Doc:      t.Doc,
+		NamesVar: strings.ToLower(t.Name[:1]) + t.Name[1:] + "Names",
+	}
+	for _, item := range t.Items {
+		data.Items = append(data.Items,
+			enumItemData{GetEnumConst(t.Name, item.Name), item.Name, item.Value})
+	}
+	return tmpl.ExecuteTemplate(w, "enum", data)
+}
+
+// GetDiscriminator returns the JSON property naming the variant of a one-of
+// type from the type's or application's discriminator attribute, "type" by
+// default
+func GetDiscriminator(app *pb.Application, t *pb.Type) string {
+	return model.GetDiscriminator(app, t)
+}
+
+// GetUnionVariants returns the type names of the variants of a Sysl OneOf type,
+// which have to reference tuple types
+func GetUnionVariants(name string, t *pb.Type,
+	types map[string]*pb.Type) ([]string, error) {
+	return model.GetUnionVariants(name, t, types)
+}
+
+// unionData is the template data of a one-of type
+type unionData struct {
+	Name          string
+	Doc           string
+	Discriminator string
+	Variants      []string
+}
+
+// WriteUnion creates a Golang struct with a pointer field per variant from a
+// Sysl OneOf type definition. Exactly one field is set, its JSON encoding holds
+// the variant type name in the discriminator property.
+func WriteUnion(w io.Writer, name string, t *pb.Type, types map[string]*pb.Type,
+	discriminator string) error {
+	variants, err := GetUnionVariants(name, t, types)
+	if err != nil {
+		return err
+	}
+	typ := &model.Type{Name: name, Kind: model.Union, Doc: t.Attrs["doc"].GetS(),
+		Variants: variants, Discriminator: discriminator, Sysl: t}
+	return writeUnion(w, builtinTemplates, typ)
+}
+
+func writeUnion(w io.Writer, tmpl *template.Template, t *model.Type) error {
+	data := unionData{t.Name, t.Doc, t.Discriminator, t.Variants}
+	return tmpl.ExecuteTemplate(w, "union", data)
+}
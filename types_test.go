@@ -2,9 +2,13 @@ package gosysl
 
 import (
 	"bytes"
+	"errors"
 	"go/format"
+	"strings"
 	"testing"
 
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/model"
 	"github.com/anz-bank/gosysl/pb"
 	testifyAssert "github.com/stretchr/testify/assert"
 )
@@ -230,7 +234,7 @@ func TestGentypesCornerCases(tt *testing.T) {
 	assert := testifyAssert.New(tt)
 
 	module := &pb.Module{}
-	_, err := Generate(module, "")
+	_, err := Generate(module)
 	assert.Error(err)
 
 	_, err = GetTypeLine(&pb.Type{})
@@ -242,7 +246,7 @@ func TestGentypesCornerCases(tt *testing.T) {
 	w := &bytes.Buffer{}
 	assert.Error(WriteTypes(w, &pb.Application{Types: types}))
 	module.Apps = map[string]*pb.Application{"x": {Types: types}}
-	_, err = Generate(module, "")
+	_, err = Generate(module)
 	assert.Error(err)
 
 	assert.Error(WriteStruct(w, "x", &pb.Type{}, "-"))
@@ -268,3 +272,391 @@ func TestGentypesCornerCases(tt *testing.T) {
 	assert.Error(WriteStructField(w, "", &pb.Type{}, ""))
 
 }
+
+func newEnumType(line int32, items map[string]int64) *pb.Type {
+	enum := &pb.Type_Enum_{Enum: &pb.Type_Enum{Items: items}}
+	return pbtest.NewLineType(line, &pb.Type{Type: enum})
+}
+
+func TestGetEnumConst(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	assert.Equal("StatusActive", GetEnumConst("Status", "ACTIVE"))
+	assert.Equal("StatusInProgress", GetEnumConst("Status", "IN_PROGRESS"))
+	assert.Equal("ColorDarkRed", GetEnumConst("Color", "dark-red"))
+}
+
+func TestWriteEnum(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	t := newEnumType(1, map[string]int64{"IN_PROGRESS": 2, "ACTIVE": 1, "DONE": 3})
+	w := &bytes.Buffer{}
+	assert.NoError(WriteEnum(w, "Status", t))
+	expected := `// Status is an enumeration.
+type Status int64
+
+// Status values
+const (
+	StatusActive     Status = 1
+	StatusInProgress Status = 2
+	StatusDone       Status = 3
+)
+
+var statusNames = map[Status]string{
+	StatusActive:     "ACTIVE",
+	StatusInProgress: "IN_PROGRESS",
+	StatusDone:       "DONE",
+}
+
+// StatusValues returns all Status values in ascending order.
+func StatusValues() []Status {
+	return []Status{
+		StatusActive,
+		StatusInProgress,
+		StatusDone,
+	}
+}
+
+// String returns the name of the Status value.
+func (e Status) String() string {
+	if name, ok := statusNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("Status(%d)", int64(e))
+}
+
+// ParseStatus returns the Status value with given name.
+func ParseStatus(name string) (Status, error) {
+	for e, n := range statusNames {
+		if n == name {
+			return e, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid Status value '%s'", name)
+}
+
+// MarshalJSON encodes Status as its name.
+func (e Status) MarshalJSON() ([]byte, error) {
+	name, ok := statusNames[e]
+	if !ok {
+		return nil, fmt.Errorf("invalid Status value %d", int64(e))
+	}
+	return json.Marshal(name)
+}
+
+// UnmarshalJSON decodes Status from its name, rejecting unknown names.
+func (e *Status) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	v, err := ParseStatus(name)
+	if err != nil {
+		return err
+	}
+	*e = v
+	return nil
+}
+
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(expected, string(actual))
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestWriteEnumError(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	t := newEnumType(1, map[string]int64{"ACTIVE": 1})
+	assert.Error(WriteEnum(failingWriter{}, "Status", t))
+}
+
+func TestWriteTypesEnum(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	enum := newEnumType(2, map[string]int64{"A": 1})
+	a := &pb.Attribute{Attribute: &pb.Attribute_S{S: "Kind of thing"}}
+	enum.Attrs = map[string]*pb.Attribute{"doc": a}
+	app := &pb.Application{Types: map[string]*pb.Type{
+		"Kind": enum,
+		"Thing": pbtest.NewLineType(1, pbtest.NewTupleType(map[string]*pb.Type{
+			"Kind": pbtest.NewRefType(1, "Kind"),
+			"At":   pbtest.NewPrimitiveType(3, pb.Type_DATETIME),
+		})),
+	}}
+	w := &bytes.Buffer{}
+	assert.NoError(WriteTypes(w, app))
+	assert.Contains(w.String(), "// Kind of thing\ntype Kind int64\n")
+	assert.Contains(w.String(), "Kind Kind `json:\"Kind\"`\n")
+	assert.Equal([]string{"encoding/json", "fmt", "time"}, GetTypesImports(app))
+	assert.Empty(GetTypesImports(&pb.Application{}))
+
+	result, err := genInterfaceFile(app, nil, "pkg")
+	assert.NoError(err)
+	imports := "import (\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"time\"\n)\n"
+	assert.Contains(string(result), imports)
+}
+
+func newUnionType(line int32, variants ...string) *pb.Type {
+	types := make([]*pb.Type, len(variants))
+	for i, v := range variants {
+		types[i] = pbtest.NewRefType(line, v)
+	}
+	oneOf := &pb.Type_OneOf_{OneOf: &pb.Type_OneOf{Type: types}}
+	return pbtest.NewLineType(line, &pb.Type{Type: oneOf})
+}
+
+func newUnionApp() *pb.Application {
+	return &pb.Application{Types: map[string]*pb.Type{
+		"Cat": pbtest.NewLineType(1, pbtest.NewTupleType(map[string]*pb.Type{
+			"Name": pbtest.NewPrimitiveType(1, pb.Type_STRING),
+		})),
+		"Dog": pbtest.NewLineType(2, pbtest.NewTupleType(map[string]*pb.Type{
+			"Breed": pbtest.NewPrimitiveType(2, pb.Type_STRING),
+		})),
+		"Pet": newUnionType(3, "Cat", "Dog"),
+	}}
+}
+
+func TestWriteUnion(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := newUnionApp()
+	w := &bytes.Buffer{}
+	err := WriteUnion(w, "Pet", app.Types["Pet"], app.Types, "kind")
+	assert.NoError(err)
+	expected := `// Pet is one of Cat, Dog.
+type Pet struct {
+	Cat *Cat
+	Dog *Dog
+}
+
+// MarshalJSON encodes the set Pet variant with its type name in "kind".
+func (u Pet) MarshalJSON() ([]byte, error) {
+	switch {
+	case u.Cat != nil:
+		return marshalUnion("kind", "Cat", u.Cat)
+	case u.Dog != nil:
+		return marshalUnion("kind", "Dog", u.Dog)
+	}
+	return nil, fmt.Errorf("no Pet variant set")
+}
+
+// UnmarshalJSON decodes the Pet variant named in "kind".
+func (u *Pet) UnmarshalJSON(data []byte) error {
+	variant, err := unmarshalUnionVariant("kind", data)
+	if err != nil {
+		return err
+	}
+	*u = Pet{}
+	switch variant {
+	case "Cat":
+		u.Cat = &Cat{}
+		return json.Unmarshal(data, u.Cat)
+	case "Dog":
+		u.Dog = &Dog{}
+		return json.Unmarshal(data, u.Dog)
+	}
+	return fmt.Errorf("invalid Pet variant '%s'", variant)
+}
+
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(expected, string(actual))
+
+	w = &bytes.Buffer{}
+	assert.NoError(WriteTypes(w, app))
+	assert.Contains(w.String(), "func marshalUnion(")
+	assert.Equal([]string{"encoding/json", "fmt"}, GetTypesImports(app))
+
+	app.Types["Pet"] = newUnionType(3, "Cat", "string")
+	assert.Error(WriteTypes(w, app))
+	app.Types["Pet"] = newUnionType(3)
+	app.Types["Pet"].SourceContext = nil
+	_, err = GetTypeLine(app.Types["Pet"])
+	assert.Error(err)
+	assert.Error(WriteUnion(w, "Pet", app.Types["Pet"], app.Types, "kind"))
+}
+
+func TestGetDiscriminator(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := newUnionApp()
+	t := app.Types["Pet"]
+	assert.Equal("type", GetDiscriminator(app, t))
+	app.Attrs = map[string]*pb.Attribute{"discriminator": pbtest.NewStringAttr("@type")}
+	assert.Equal("@type", GetDiscriminator(app, t))
+	t.Attrs = map[string]*pb.Attribute{"discriminator": pbtest.NewStringAttr("kind")}
+	assert.Equal("kind", GetDiscriminator(app, t))
+}
+
+func newOptionalApp(strategy string) *pb.Application {
+	nick := pbtest.NewPrimitiveType(2, pb.Type_STRING)
+	nick.Opt = true
+	born := pbtest.NewPrimitiveType(3, pb.Type_DATE)
+	born.Opt = true
+	tags := pbtest.NewLineType(4, &pb.Type{Type: &pb.Type_List_{
+		List: &pb.Type_List{Type: pbtest.NewPrimitiveType(4, pb.Type_STRING)},
+	}})
+	tags.Opt = true
+	app := &pb.Application{Types: map[string]*pb.Type{
+		"Person": pbtest.NewLineType(1, pbtest.NewTupleType(map[string]*pb.Type{
+			"Name": pbtest.NewPrimitiveType(1, pb.Type_STRING),
+			"Nick": nick,
+			"Born": born,
+			"Tags": tags,
+		})),
+	}}
+	if strategy != "" {
+		attr := pbtest.NewStringAttr(strategy)
+		app.Attrs = map[string]*pb.Attribute{"optional_fields": attr}
+	}
+	return app
+}
+
+func TestWriteTypesOptional(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	var tests = []struct {
+		strategy string
+		expected string
+	}{
+		{"", `type Person struct {
+	Name string     ` + "`json:\"Name\"`" + `
+	Nick *string    ` + "`json:\"Nick,omitempty\"`" + `
+	Born *time.Time ` + "`json:\"Born,omitempty\"`" + `
+	Tags []string   ` + "`json:\"Tags,omitempty\"`" + `
+}
+`},
+		{OptionalOmitEmpty, `type Person struct {
+	Name string    ` + "`json:\"Name\"`" + `
+	Nick string    ` + "`json:\"Nick,omitempty\"`" + `
+	Born time.Time ` + "`json:\"Born,omitempty\"`" + `
+	Tags []string  ` + "`json:\"Tags,omitempty\"`" + `
+}
+`},
+		{OptionalWrapper, `type Person struct {
+	Name string         ` + "`json:\"Name\"`" + `
+	Nick OptionalString ` + "`json:\"Nick\"`" + `
+	Born OptionalTime   ` + "`json:\"Born\"`" + `
+	Tags []string       ` + "`json:\"Tags,omitempty\"`" + `
+}
+`},
+	}
+	for _, t := range tests {
+		w := &bytes.Buffer{}
+		assert.NoError(WriteTypes(w, newOptionalApp(t.strategy)))
+		actual, err := format.Source(w.Bytes())
+		assert.NoError(err)
+		assert.True(strings.HasPrefix(string(actual), t.expected), string(actual))
+	}
+
+	app := newOptionalApp(OptionalWrapper)
+	w := &bytes.Buffer{}
+	assert.NoError(WriteTypes(w, app))
+	assert.Contains(w.String(), "type OptionalString struct {\n\tValue string\n")
+	assert.Contains(w.String(), "type OptionalTime struct {\n\tValue time.Time\n")
+	assert.NotContains(w.String(), "OptionalStringList")
+	assert.Equal([]string{"encoding/json", "time"}, GetTypesImports(app))
+	assert.Equal([]string{"time"}, GetTypesImports(newOptionalApp("")))
+
+	assert.Error(WriteTypes(w, newOptionalApp("nullable")))
+}
+
+func TestWriteStructOptional(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	person := newOptionalApp("").Types["Person"]
+	w := &bytes.Buffer{}
+	assert.NoError(WriteStructOptional(w, "Person", person, "", OptionalOmitEmpty))
+	assert.Contains(w.String(), "Nick string")
+	w.Reset()
+	assert.NoError(WriteStruct(w, "Person", person, ""))
+	assert.Contains(w.String(), "Nick *string")
+
+	nick := person.GetTuple().AttrDefs["Nick"]
+	w.Reset()
+	assert.NoError(WriteStructFieldOptional(w, "Nick", nick, "", OptionalWrapper))
+	assert.Contains(w.String(), "Nick OptionalString")
+	w.Reset()
+	assert.NoError(WriteStructField(w, "Nick", nick, ""))
+	assert.Contains(w.String(), "Nick *string")
+	assert.Error(WriteStructOptional(w, "x", &pb.Type{}, "", OptionalPointer))
+}
+
+func TestGetOptionalType(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	var tests = []struct {
+		typeStr, strategy, expected, tagOpts string
+	}{
+		{"int", OptionalPointer, "*int", ",omitempty"},
+		{"Status", OptionalPointer, "*Status", ",omitempty"},
+		{"[]byte", OptionalPointer, "[]byte", ",omitempty"},
+		{"map[string]int", OptionalWrapper, "map[string]int", ",omitempty"},
+		{"interface{}", OptionalWrapper, "interface{}", ",omitempty"},
+		{"float64", OptionalWrapper, "OptionalFloat64", ""},
+		{"time.Time", OptionalWrapper, "OptionalTime", ""},
+		{"int", OptionalOmitEmpty, "int", ",omitempty"},
+		{"Person", OptionalOmitEmpty, "*Person", ",omitempty"},
+		{"Person", OptionalWrapper, "*Person", ",omitempty"},
+		{"Pet", OptionalWrapper, "*Pet", ",omitempty"},
+		{"Kind", OptionalWrapper, "OptionalKind", ""},
+	}
+	types := model.Types{
+		{Name: "Person", Kind: model.Struct},
+		{Name: "Pet", Kind: model.Union},
+		{Name: "Kind", Kind: model.Enum},
+	}
+	for _, t := range tests {
+		typeStr, tagOpts := GetOptionalType(t.typeStr, t.strategy, types)
+		assert.Equal(t.expected, typeStr)
+		assert.Equal(t.tagOpts, tagOpts)
+	}
+}
+
+func TestRecursiveOptional(tt *testing.T) {
+	for _, strategy := range []string{OptionalPointer, OptionalOmitEmpty, OptionalWrapper} {
+		app := newOptionalApp(strategy)
+		app.Attrs["router"] = pbtest.NewStringAttr(RouterServeMux)
+		best := pbtest.NewRefType(5, "Person")
+		best.Opt = true
+		app.Types["Person"].GetTuple().AttrDefs["Best"] = best
+		runGenerated(tt, app, recursiveOptionalTest)
+	}
+}
+
+const recursiveOptionalTest = `package gen
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRecursive(t *testing.T) {
+	var p Person
+	data := ` + "`" + `{"Name": "Tom", "Best": {"Name": "Jerry"}}` + "`" + `
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Best == nil || p.Best.Name != "Jerry" || p.Best.Best != nil {
+		t.Errorf("unexpected value %+v", p)
+	}
+	if err := p.Validate(); err != nil {
+		t.Error(err)
+	}
+	b, err := json.Marshal(p.Best)
+	if err != nil || strings.Contains(string(b), "Best") {
+		t.Error(string(b), err)
+	}
+}
+`
@@ -0,0 +1,408 @@
+package gosysl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/anz-bank/gosysl/model"
+	"github.com/anz-bank/gosysl/pb"
+)
+
+// WriteValidate creates a Validate method for every type of a Sysl application,
+// checking required fields and the Sysl type constraints
+func WriteValidate(w io.Writer, app *pb.Application) error {
+	types, err := model.NewTypes(app)
+	if err != nil {
+		return err
+	}
+	optional, err := GetOptionalStrategy(app)
+	if err != nil {
+		return err
+	}
+	presence := getPresenceTypes(types)
+	for _, t := range types {
+		switch t.Kind {
+		case model.Enum:
+			// enum values are validated on unmarshalling
+		case model.Union:
+			writeValidateUnion(w, t)
+		default:
+			writeValidateMethod(w, t, types, optional)
+		}
+		if presence[t.Name] {
+			writeValidatePresence(w, t, types, presence)
+		}
+	}
+	return nil
+}
+
+func writeValidateMethod(w io.Writer, t *model.Type, types model.Types, optional string) {
+	fmt.Fprintf(w, "// Validate checks %s against its Sysl type constraints.\n", t.Name)
+	fmt.Fprintf(w, "func (t %s) Validate() error {\n", t.Name)
+	fmt.Fprintln(w, "v := &validator{}")
+	for _, f := range t.Fields {
+		writeValidateField(w, f, types, optional)
+	}
+	fmt.Fprint(w, "return v.err()\n}\n\n")
+}
+
+// getPresenceChecked returns the JSON properties of the required fields of t
+// whose zero value cannot be told apart from a missing value after decoding
+func getPresenceChecked(t *model.Type) []string {
+	var names []string
+	for _, f := range t.Fields {
+		if !f.Optional && !isNilable(f.GoType) {
+			names = append(names, fmt.Sprintf("%q", f.JSON))
+		}
+	}
+	return names
+}
+
+// getNestedType returns the struct or union type held by field f directly or
+// as list element, or "" if there is none
+func getNestedType(types model.Types, f *model.Field) string {
+	name := f.GoType
+	if f.Sysl.GetList() != nil {
+		name = name[2:]
+	}
+	if isValidated(types, name) {
+		return name
+	}
+	return ""
+}
+
+// getPresenceTypes returns the names of the struct and union types having
+// required properties checked on the JSON document, directly or nested
+func getPresenceTypes(types model.Types) map[string]bool {
+	presence := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, t := range types {
+			if presence[t.Name] || !needsPresence(t, types, presence) {
+				continue
+			}
+			presence[t.Name] = true
+			changed = true
+		}
+	}
+	return presence
+}
+
+func needsPresence(t *model.Type, types model.Types, presence map[string]bool) bool {
+	switch t.Kind {
+	case model.Struct:
+		if len(getPresenceChecked(t)) > 0 {
+			return true
+		}
+		for _, f := range t.Fields {
+			if presence[getNestedType(types, f)] {
+				return true
+			}
+		}
+	case model.Union:
+		for _, v := range t.Variants {
+			if presence[v] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeValidatePresence writes the ValidatePresence method of a type and the
+// checkPresence method reporting the required properties missing or null in a
+// JSON document, nested ones prefixed with their path
+func writeValidatePresence(w io.Writer, t *model.Type, types model.Types,
+	presence map[string]bool) {
+	format := "// ValidatePresence checks the required properties of %s are present\n" +
+		"// and not null in the JSON document data.\n"
+	fmt.Fprintf(w, format, t.Name)
+	fmt.Fprintf(w, "func (t %s) ValidatePresence(data []byte) error {\n", t.Name)
+	fmt.Fprint(w, "v := &validator{}\nt.checkPresence(v, \"\", data)\nreturn v.err()\n}\n\n")
+	format = "// checkPresence adds the ValidatePresence violations under path.\n" +
+		"func (%s) checkPresence(v *validator, path string, data []byte) {\n"
+	fmt.Fprintf(w, format, t.Name)
+	if t.Kind == model.Union {
+		format = "switch variant, _ := unmarshalUnionVariant(%q, data); variant {\n"
+		fmt.Fprintf(w, format, t.Discriminator)
+		for _, v := range t.Variants {
+			if presence[v] {
+				format = "case %q:\n%s{}.checkPresence(v, path, data)\n"
+				fmt.Fprintf(w, format, v, v)
+			}
+		}
+		fmt.Fprint(w, "}\n}\n\n")
+		return
+	}
+	fmt.Fprintln(w, "fields := jsonObject(data)")
+	if names := getPresenceChecked(t); len(names) > 0 {
+		fmt.Fprintf(w, "v.present(path, fields, %s)\n", strings.Join(names, ", "))
+	}
+	for _, f := range t.Fields {
+		nested := getNestedType(types, f)
+		switch {
+		case !presence[nested]:
+		case f.Sysl.GetList() != nil:
+			format = "for i, e := range jsonArray(fields[%q]) {\n" +
+				"%s{}.checkPresence(v, fmt.Sprintf(\"%%s%s[%%d].\", path, i), e)\n}\n"
+			fmt.Fprintf(w, format, f.JSON, nested, f.JSON)
+		default:
+			format = "%s{}.checkPresence(v, path+\"%s.\", fields[%q])\n"
+			fmt.Fprintf(w, format, nested, f.JSON, f.JSON)
+		}
+	}
+	fmt.Fprint(w, "}\n\n")
+}
+
+func writeValidateUnion(w io.Writer, t *model.Type) {
+	format := "// Validate checks the set %s variant against its Sysl type constraints.\n"
+	fmt.Fprintf(w, format, t.Name)
+	fmt.Fprintf(w, "func (u %s) Validate() error {\nswitch {\n", t.Name)
+	for _, v := range t.Variants {
+		fmt.Fprintf(w, "case u.%s != nil:\nreturn u.%s.Validate()\n", v, v)
+	}
+	format = "}\nreturn &ValidationError{[]Violation{{\"%s\", \"is required\"}}}\n}\n\n"
+	fmt.Fprintf(w, format, t.Discriminator)
+}
+
+func writeValidateField(w io.Writer, f *model.Field, types model.Types, optional string) {
+	field := "t." + f.Name
+	zeroCheck := getZeroCheck(field, f.GoType)
+	if f.Optional {
+		// checks apply to the value of pointers and wrappers
+		switch optTypeStr, _ := GetOptionalType(f.GoType, optional, types); {
+		case strings.HasPrefix(optTypeStr, "*"):
+			zeroCheck = field + " != nil"
+			field = "*" + field
+		case optTypeStr != f.GoType:
+			zeroCheck = field + ".Set"
+			field += ".Value"
+		}
+	}
+	checks := &bytes.Buffer{}
+	writeConstraintChecks(checks, f.JSON, field, f.Sysl)
+	if nested := getNestedType(types, f); nested != "" && f.Sysl.GetList() != nil {
+		format := "for i, e := range %s {\nv.nested(fmt.Sprintf(\"%s[%%d]\", i), e)\n}\n"
+		fmt.Fprintf(checks, format, field, f.JSON)
+	} else if nested != "" {
+		fmt.Fprintf(checks, "v.nested(\"%s\", %s)\n", f.JSON, field)
+	}
+	switch {
+	case f.Optional && zeroCheck != "" && checks.Len() > 0:
+		// optional fields are only checked if present
+		fmt.Fprintf(w, "if %s {\n%s}\n", zeroCheck, checks)
+	case f.Optional || !isNilable(f.GoType):
+		// the presence of other required fields is checked by ValidatePresence
+		fmt.Fprint(w, checks)
+	default:
+		fmt.Fprintf(w, "v.required(\"%s\", %s)\n", f.JSON, zeroCheck)
+		fmt.Fprint(w, checks)
+	}
+}
+
+// isValidated reports whether the named type has a generated Validate method
+func isValidated(types model.Types, name string) bool {
+	return types.Is(name, model.Struct) || types.Is(name, model.Union)
+}
+
+// getZeroCheck returns an expression reporting whether field of Go type typeStr
+// is set, or "" if a missing value cannot be told apart from a zero value
+func getZeroCheck(field, typeStr string) string {
+	switch {
+	case typeStr == "string":
+		return field + ` != ""`
+	case typeStr == "time.Time":
+		return "!" + field + ".IsZero()"
+	case isNilable(typeStr):
+		return field + " != nil"
+	}
+	return ""
+}
+
+func writeConstraintChecks(w io.Writer, jsonProp, field string, t *pb.Type) {
+	for _, c := range t.Constraint {
+		if l := c.GetLength(); l != nil && t.GetPrimitive() == pb.Type_STRING {
+			fmt.Fprintf(w, "v.length(\"%s\", %s, %d, %d)\n", jsonProp, field, l.Min, l.Max)
+		}
+		if r := c.GetRange(); r != nil && isNumber(t) {
+			if min := getValueLiteral(r.Min); min != "" {
+				fmt.Fprintf(w, "v.min(\"%s\", float64(%s), %s)\n", jsonProp, field, min)
+			}
+			if max := getValueLiteral(r.Max); max != "" {
+				fmt.Fprintf(w, "v.max(\"%s\", float64(%s), %s)\n", jsonProp, field, max)
+			}
+		}
+		if c.Precision > 0 && t.GetPrimitive() == pb.Type_DECIMAL {
+			format := "v.decimal(\"%s\", %s, %d, %d)\n"
+			fmt.Fprintf(w, format, jsonProp, field, c.Precision, c.Scale)
+		}
+	}
+}
+
+func isNumber(t *pb.Type) bool {
+	switch t.GetPrimitive() {
+	case pb.Type_INT, pb.Type_FLOAT, pb.Type_DECIMAL:
+		return true
+	}
+	return false
+}
+
+// getValueLiteral returns the Go literal for a numeric range bound or "" if unbounded
+func getValueLiteral(v *pb.Value) string {
+	switch v.GetValue().(type) {
+	case *pb.Value_I:
+		return strconv.FormatInt(v.GetI(), 10)
+	case *pb.Value_D:
+		return strconv.FormatFloat(v.GetD(), 'g', -1, 64)
+	case *pb.Value_Decimal:
+		return v.GetDecimal()
+	}
+	return ""
+}
+
+const validatePrefix = `import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Violation describes a constraint violation of a payload field.
+type Violation struct {
+	Field   string ` + "`json:\"field\"`" + `
+	Message string ` + "`json:\"message\"`" + `
+}
+
+// ValidationError holds all constraint violations of a payload, it implements
+// DetailedError.
+type ValidationError struct {
+	Violations []Violation ` + "`json:\"violations\"`" + `
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.Field + " " + v.Message
+	}
+	return "invalid payload: " + strings.Join(msgs, ", ")
+}
+
+// Status returns http.StatusBadRequest.
+func (e *ValidationError) Status() int {
+	return http.StatusBadRequest
+}
+
+// Code returns "invalid_payload".
+func (e *ValidationError) Code() string {
+	return "invalid_payload"
+}
+
+// Details returns the violations.
+func (e *ValidationError) Details() interface{} {
+	return e.Violations
+}
+
+type validator struct {
+	violations []Violation
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.violations = append(v.violations, Violation{field, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field string, ok bool) {
+	if !ok {
+		v.add(field, "is required")
+	}
+}
+
+func (v *validator) length(field, s string, min, max int) {
+	n := utf8.RuneCountInString(s)
+	if n < min {
+		v.add(field, "must be at least %d characters long", min)
+	}
+	if max > 0 && n > max {
+		v.add(field, "must be at most %d characters long", max)
+	}
+}
+
+func (v *validator) min(field string, x, min float64) {
+	if x < min {
+		v.add(field, "must be at least %v", min)
+	}
+}
+
+func (v *validator) max(field string, x, max float64) {
+	if x > max {
+		v.add(field, "must be at most %v", max)
+	}
+}
+
+func (v *validator) decimal(field string, x float64, precision, scale int) {
+	digits := strings.TrimLeft(strconv.FormatFloat(x, 'f', -1, 64), "-")
+	intDigits, fracDigits := digits, ""
+	if i := strings.Index(digits, "."); i >= 0 {
+		intDigits, fracDigits = digits[:i], digits[i+1:]
+	}
+	intDigits = strings.TrimLeft(intDigits, "0")
+	if len(intDigits) > precision-scale || len(fracDigits) > scale {
+		v.add(field, "must have at most %d digits and %d decimal places", precision, scale)
+	}
+}
+
+func (v *validator) nested(field string, x interface{ Validate() error }) {
+	err := x.Validate()
+	if ve, ok := err.(*ValidationError); ok {
+		for _, violation := range ve.Violations {
+			violation.Field = field + "." + violation.Field
+			v.violations = append(v.violations, violation)
+		}
+	} else if err != nil {
+		v.add(field, "%s", err)
+	}
+}
+
+// present adds a violation for each of the properties missing or null in the
+// JSON object fields, prefixed with path. Other JSON values, whose fields are
+// nil, are left to the decoder.
+func (v *validator) present(path string, fields map[string]json.RawMessage,
+	names ...string) {
+	if fields == nil {
+		return
+	}
+	for _, name := range names {
+		value, ok := fields[name]
+		v.required(path+name, ok && string(value) != "null")
+	}
+}
+
+// jsonObject returns the properties of the JSON object data, nil for other JSON values
+func jsonObject(data []byte) map[string]json.RawMessage {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// jsonArray returns the elements of the JSON array data, nil for other JSON values
+func jsonArray(data []byte) []json.RawMessage {
+	var elems []json.RawMessage
+	if err := json.Unmarshal(data, &elems); err != nil {
+		return nil
+	}
+	return elems
+}
+
+func (v *validator) err() error {
+	if len(v.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{v.violations}
+}
+`
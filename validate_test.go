@@ -0,0 +1,306 @@
+package gosysl
+
+import (
+	"bytes"
+	"go/format"
+	"testing"
+
+	"github.com/anz-bank/gosysl/internal/pbtest"
+	"github.com/anz-bank/gosysl/pb"
+	testifyAssert "github.com/stretchr/testify/assert"
+)
+
+func TestWriteValidate(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	name := pbtest.NewPrimitiveType(1, pb.Type_STRING)
+	length := &pb.Type_Constraint_Length{Min: 1, Max: 10}
+	name.Constraint = []*pb.Type_Constraint{{Length: length}}
+	age := pbtest.NewPrimitiveType(2, pb.Type_INT)
+	ageRange := &pb.Type_Constraint_Range{
+		Min: &pb.Value{Value: &pb.Value_I{I: 0}},
+		Max: &pb.Value{Value: &pb.Value_D{D: 150.5}},
+	}
+	age.Constraint = []*pb.Type_Constraint{{Range: ageRange}}
+	amount := pbtest.NewPrimitiveType(3, pb.Type_DECIMAL)
+	amount.Constraint = []*pb.Type_Constraint{{Precision: 10, Scale: 2}}
+	nick := pbtest.NewPrimitiveType(4, pb.Type_STRING)
+	nick.Opt = true
+	nick.Constraint = name.Constraint
+	note := pbtest.NewPrimitiveType(5, pb.Type_STRING)
+	note.Opt = true
+	childList := &pb.Type_List{Type: pbtest.NewRefType(7, "Child")}
+	children := &pb.Type{Type: &pb.Type_List_{List: childList}}
+	types := map[string]*pb.Type{
+		"Person": pbtest.NewLineType(1, pbtest.NewTupleType(map[string]*pb.Type{
+			"Name":     name,
+			"Age":      age,
+			"Amount":   amount,
+			"Nick":     nick,
+			"Note":     note,
+			"Partner":  pbtest.NewRefType(6, "Child"),
+			"Children": children,
+		})),
+		"Child": pbtest.NewLineType(10, pbtest.NewTupleType(map[string]*pb.Type{
+			"Name": pbtest.NewPrimitiveType(10, pb.Type_STRING),
+		})),
+	}
+	a := &pb.Attribute{Attribute: &pb.Attribute_S{S: "-"}}
+	app := &pb.Application{
+		Types: types,
+		Attrs: map[string]*pb.Attribute{"json_property_separator": a},
+	}
+
+	w := &bytes.Buffer{}
+	assert.NoError(WriteValidate(w, app))
+	expected := `// Validate checks Person against its Sysl type constraints.
+func (t Person) Validate() error {
+	v := &validator{}
+	v.length("name", t.Name, 1, 10)
+	v.min("age", float64(t.Age), 0)
+	v.max("age", float64(t.Age), 150.5)
+	v.decimal("amount", t.Amount, 10, 2)
+	if t.Nick != nil {
+		v.length("nick", *t.Nick, 1, 10)
+	}
+	v.nested("partner", t.Partner)
+	v.required("children", t.Children != nil)
+	for i, e := range t.Children {
+		v.nested(fmt.Sprintf("children[%d]", i), e)
+	}
+	return v.err()
+}
+
+// ValidatePresence checks the required properties of Person are present
+// and not null in the JSON document data.
+func (t Person) ValidatePresence(data []byte) error {
+	v := &validator{}
+	t.checkPresence(v, "", data)
+	return v.err()
+}
+
+// checkPresence adds the ValidatePresence violations under path.
+func (Person) checkPresence(v *validator, path string, data []byte) {
+	fields := jsonObject(data)
+	v.present(path, fields, "name", "age", "amount", "partner")
+	Child{}.checkPresence(v, path+"partner.", fields["partner"])
+	for i, e := range jsonArray(fields["children"]) {
+		Child{}.checkPresence(v, fmt.Sprintf("%schildren[%d].", path, i), e)
+	}
+}
+
+// Validate checks Child against its Sysl type constraints.
+func (t Child) Validate() error {
+	v := &validator{}
+	return v.err()
+}
+
+// ValidatePresence checks the required properties of Child are present
+// and not null in the JSON document data.
+func (t Child) ValidatePresence(data []byte) error {
+	v := &validator{}
+	t.checkPresence(v, "", data)
+	return v.err()
+}
+
+// checkPresence adds the ValidatePresence violations under path.
+func (Child) checkPresence(v *validator, path string, data []byte) {
+	fields := jsonObject(data)
+	v.present(path, fields, "name")
+}
+
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Equal(expected, string(actual))
+
+	_, err = genValidateFile(app, "pkg")
+	assert.NoError(err)
+}
+
+func TestValidatePresence(tt *testing.T) {
+	nick := pbtest.NewPrimitiveType(3, pb.Type_STRING)
+	nick.Opt = true
+	childList := &pb.Type_List{Type: pbtest.NewRefType(6, "Child")}
+	ret := &pb.Statement{Stmt: &pb.Statement_Ret{Ret: &pb.Return{Payload: "Person"}}}
+	ref := &pb.ScopedRef{Ref: &pb.Scope{Appname: &pb.AppName{Part: []string{"Person"}}}}
+	param := &pb.Param{Name: "p", Type: &pb.Type{Type: &pb.Type_TypeRef{TypeRef: ref}}}
+	post := &pb.Endpoint{Name: "POST /people", Param: []*pb.Param{param},
+		Stmt: []*pb.Statement{ret}}
+	app := &pb.Application{
+		Endpoints: map[string]*pb.Endpoint{post.Name: post},
+		Types: map[string]*pb.Type{
+			"Person": pbtest.NewLineType(1, pbtest.NewTupleType(map[string]*pb.Type{
+				"Name":     pbtest.NewPrimitiveType(1, pb.Type_STRING),
+				"Age":      pbtest.NewPrimitiveType(2, pb.Type_INT),
+				"Nick":     nick,
+				"Active":   pbtest.NewPrimitiveType(4, pb.Type_BOOL),
+				"Partner":  pbtest.NewRefType(5, "Child"),
+				"Children": pbtest.NewLineType(6, &pb.Type{Type: &pb.Type_List_{List: childList}}),
+			})),
+			"Child": pbtest.NewLineType(10, pbtest.NewTupleType(map[string]*pb.Type{
+				"Name": pbtest.NewPrimitiveType(10, pb.Type_STRING),
+			})),
+		},
+		Attrs: map[string]*pb.Attribute{"router": pbtest.NewStringAttr(RouterServeMux)},
+	}
+	runGenerated(tt, app, validatePresenceTest)
+}
+
+const validatePresenceTest = `package gen
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type storer struct{}
+
+func (storer) PostPeople(p Person) (Person, error) { return p, nil }
+
+type middleware struct{}
+
+func (middleware) Root() []func(http.Handler) http.Handler { return nil }
+
+func TestPresence(t *testing.T) {
+	// decoding accepts missing properties, they are reported by ValidatePresence
+	data := []byte(` + "`" + `{"Name": null, "Nick": "x", "Partner": {},
+		"Children": [{"Name": "a"}, {}]}` + "`" + `)
+	var p Person
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	err := p.ValidatePresence(data)
+	expected := "invalid payload: Name is required, Age is required, " +
+		"Active is required, Partner.Name is required, Children[1].Name is required"
+	if err == nil || err.Error() != expected {
+		t.Fatal(err)
+	}
+	if _, ok := err.(*ValidationError); !ok {
+		t.Errorf("unexpected error type %T", err)
+	}
+	if err := p.ValidatePresence([]byte("null")); err != nil {
+		t.Error(err)
+	}
+
+	h := NewRestHandler(storer{}, middleware{})
+	zero := ` + "`" + `{"Name": "", "Age": 0, "Active": false, "Partner": {"Name": ""},
+		"Children": []}` + "`" + `
+	bodies := map[string]int{zero: http.StatusCreated, string(data): http.StatusBadRequest}
+	for body, status := range bodies {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/people", strings.NewReader(body)))
+		if w.Code != status {
+			t.Errorf("unexpected status %d: %s", w.Code, w.Body)
+		}
+	}
+}
+`
+
+func TestValidateCornerCases(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	w := &bytes.Buffer{}
+	types := map[string]*pb.Type{"x": {}}
+	assert.Error(WriteValidate(w, &pb.Application{Types: types}))
+
+	types = map[string]*pb.Type{"x": pbtest.NewPrimitiveType(1, pb.Type_STRING)}
+	assert.Error(WriteValidate(w, &pb.Application{Types: types}))
+
+	x := pbtest.NewTupleType(map[string]*pb.Type{"Data": {}})
+	types = map[string]*pb.Type{"x": pbtest.NewLineType(1, x)}
+	assert.Error(WriteValidate(w, &pb.Application{Types: types}))
+
+	x = pbtest.NewTupleType(map[string]*pb.Type{
+		"Data": pbtest.NewPrimitiveType(1, pb.Type_XML),
+	})
+	types = map[string]*pb.Type{"x": pbtest.NewLineType(1, x)}
+	assert.Error(WriteValidate(w, &pb.Application{Types: types}))
+	_, err := genValidateFile(&pb.Application{Types: types}, "pkg")
+	assert.Error(err)
+
+	assert.Equal("", getValueLiteral(nil))
+	assert.Equal("1.5", getValueLiteral(&pb.Value{Value: &pb.Value_Decimal{Decimal: "1.5"}}))
+	assert.Equal("", getZeroCheck("t.X", "int"))
+}
+
+func TestWriteValidateUnion(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	app := newUnionApp()
+	app.Types["Owner"] = pbtest.NewLineType(4, pbtest.NewTupleType(map[string]*pb.Type{
+		"Pets": pbtest.NewLineType(4, &pb.Type{Type: &pb.Type_List_{
+			List: &pb.Type_List{Type: pbtest.NewRefType(4, "Pet")},
+		}}),
+	}))
+	w := &bytes.Buffer{}
+	assert.NoError(WriteValidate(w, app))
+	expected := `// Validate checks the set Pet variant against its Sysl type constraints.
+func (u Pet) Validate() error {
+	switch {
+	case u.Cat != nil:
+		return u.Cat.Validate()
+	case u.Dog != nil:
+		return u.Dog.Validate()
+	}
+	return &ValidationError{[]Violation{{"type", "is required"}}}
+}
+`
+	actual, err := format.Source(w.Bytes())
+	assert.NoError(err)
+	assert.Contains(string(actual), expected)
+	assert.Contains(string(actual), "v.nested(fmt.Sprintf(\"Pets[%d]\", i), e)\n")
+	expected = `func (Pet) checkPresence(v *validator, path string, data []byte) {
+	switch variant, _ := unmarshalUnionVariant("type", data); variant {
+	case "Cat":
+		Cat{}.checkPresence(v, path, data)
+	case "Dog":
+		Dog{}.checkPresence(v, path, data)
+	}
+}
+`
+	assert.Contains(string(actual), expected)
+	expected = "Pet{}.checkPresence(v, fmt.Sprintf(\"%sPets[%d].\", path, i), e)\n"
+	assert.Contains(string(actual), expected)
+
+	app.Types["Pet"] = newUnionType(3, "Cat", "Owner", "Bird")
+	assert.Error(WriteValidate(w, app))
+}
+
+func TestValidateOptional(tt *testing.T) {
+	assert := testifyAssert.New(tt)
+
+	var tests = []struct {
+		strategy string
+		expected string
+	}{
+		{OptionalPointer, `	if t.Nick != nil {
+		v.length("Nick", *t.Nick, 1, 10)
+	}
+`},
+		{OptionalOmitEmpty, `	if t.Nick != "" {
+		v.length("Nick", t.Nick, 1, 10)
+	}
+`},
+		{OptionalWrapper, `	if t.Nick.Set {
+		v.length("Nick", t.Nick.Value, 1, 10)
+	}
+`},
+	}
+	for _, t := range tests {
+		app := newOptionalApp(t.strategy)
+		length := &pb.Type_Constraint_Length{Min: 1, Max: 10}
+		nick := app.Types["Person"].GetTuple().AttrDefs["Nick"]
+		nick.Constraint = []*pb.Type_Constraint{{Length: length}}
+		w := &bytes.Buffer{}
+		assert.NoError(WriteValidate(w, app))
+		actual, err := format.Source(w.Bytes())
+		assert.NoError(err)
+		assert.Contains(string(actual), t.expected)
+	}
+
+	assert.Error(WriteValidate(&bytes.Buffer{}, newOptionalApp("nullable")))
+}